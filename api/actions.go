@@ -0,0 +1,327 @@
+package api
+
+import (
+	"context"
+	"hnews/hn"
+	"hnews/outbox"
+	"hnews/scraper"
+	"hnews/services"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ItemRequest is the body of the actions on an item
+type ItemRequest struct {
+	ID int `form:"id" json:"id" binding:"required"`
+}
+
+// CommentRequest is the body of /v1/login/entry/comment
+type CommentRequest struct {
+	ID      int    `form:"id" json:"id" binding:"required"`
+	Comment string `form:"comment" json:"comment" binding:"required"`
+}
+
+// ReplyRequest is the body of /v1/login/commment/reply
+type ReplyRequest struct {
+	ID    int    `form:"id" json:"id" binding:"required"`
+	Reply string `form:"reply" json:"reply" binding:"required"`
+}
+
+// EditRequest is the body of /v1/item/:id/edit
+type EditRequest struct {
+	Text string `form:"text" json:"text" binding:"required"`
+}
+
+// PageQuery is the query of the lists of the user on Hacker News, /v1/me/favorites and /v1/me/hidden
+type PageQuery struct {
+	Page     int  `form:"page" binding:"omitempty,min=1"`
+	Comments bool `form:"comments"` // Only used by /v1/me/favorites
+}
+
+// Pages start at 1
+func (query PageQuery) page() int {
+	if query.Page == 0 {
+		return 1
+	}
+	return query.Page
+}
+
+// SubmitRequest is the body of /v1/submit, a story has either a URL or a text
+type SubmitRequest struct {
+	Title string `form:"title" json:"title" binding:"required,max=80"`
+	URL   string `form:"url" json:"url" binding:"omitempty,url"`
+	Text  string `form:"text" json:"text"`
+}
+
+// The actions on an item that only take its id, see /v1/item/:id/:action
+var itemActions = map[string]func(*hn.Session, context.Context, int) error{
+	"favorite":   (*hn.Session).Favorite,
+	"unfavorite": (*hn.Session).Unfavorite,
+	"hide":       (*hn.Session).Hide,
+	"unhide":     (*hn.Session).Unhide,
+	"flag":       (*hn.Session).Flag,
+	"unflag":     (*hn.Session).Unflag,
+	"unvote":     (*hn.Session).Unvote,
+}
+
+// Sets up the routes of the actions a logged in user performs on Hacker News
+func (api *API) actionRoutes(auth *gin.RouterGroup) {
+	/** Entry actions **/
+	auth.POST("/login/entry/upvote", func(c *gin.Context) {
+		var req ItemRequest
+		session, ok := api.actionParams(c, &req)
+		if !ok {
+			return
+		}
+		if err := session.Upvote(c.Request.Context(), req.ID); err != nil {
+			api.queueOrFail(c, err, services.OutboxAction{Kind: outbox.Upvote, Item: req.ID})
+			return
+		}
+		api.votes.set(session.Username, req.ID, true)
+		c.JSON(http.StatusOK, gin.H{"id": req.ID})
+	})
+
+	auth.POST("/login/entry/comment", func(c *gin.Context) {
+		var req CommentRequest
+		session, ok := api.actionParams(c, &req)
+		if !ok {
+			return
+		}
+		if err := session.Comment(c.Request.Context(), req.ID, req.Comment); err != nil {
+			api.queueOrFail(c, err, services.OutboxAction{Kind: outbox.Comment, Item: req.ID, Text: req.Comment})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": req.ID})
+	})
+
+	auth.POST("/submit", func(c *gin.Context) {
+		var req SubmitRequest
+		session, ok := api.actionParams(c, &req)
+		if !ok {
+			return
+		}
+		if (req.URL == "") == (req.Text == "") {
+			failMessage(c, "bad_request", "Submit either a url or a text", nil)
+			return
+		}
+
+		id, err := session.Submit(c.Request.Context(), req.Title, req.URL, req.Text)
+		if err == hn.ErrDuplicate {
+			fail(c, "duplicate_url", gin.H{"id": id})
+			return
+		}
+		if err != nil {
+			api.queueOrFail(c, err, services.OutboxAction{Kind: outbox.Submit, Title: req.Title, URL: req.URL, Text: req.Text})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id})
+	})
+
+	/** Comment actions **/
+	auth.POST("/login/comment/upvote", func(c *gin.Context) {
+		var req ItemRequest
+		session, ok := api.actionParams(c, &req)
+		if !ok {
+			return
+		}
+		if err := session.Upvote(c.Request.Context(), req.ID); err != nil {
+			api.queueOrFail(c, err, services.OutboxAction{Kind: outbox.Upvote, Item: req.ID})
+			return
+		}
+		api.votes.set(session.Username, req.ID, true)
+		c.JSON(http.StatusOK, gin.H{"id": req.ID})
+	})
+
+	auth.POST("/login/commment/reply", func(c *gin.Context) {
+		var req ReplyRequest
+		session, ok := api.actionParams(c, &req)
+		if !ok {
+			return
+		}
+		if err := session.Reply(c.Request.Context(), req.ID, req.Reply); err != nil {
+			api.queueOrFail(c, err, services.OutboxAction{Kind: outbox.Reply, Item: req.ID, Text: req.Reply})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": req.ID})
+	})
+
+	/** Item actions **/
+	for name, action := range itemActions {
+		name, action := name, action
+		auth.POST("/item/:id/"+name, func(c *gin.Context) {
+			id, ok := idParam(c)
+			if !ok {
+				return
+			}
+			session, ok := hnSession(c)
+			if !ok {
+				return
+			}
+			if err := action(session, c.Request.Context(), id); err != nil {
+				actionError(c, err)
+				return
+			}
+			if name == "unvote" {
+				api.votes.set(session.Username, id, false)
+			}
+			c.JSON(http.StatusOK, gin.H{"id": id})
+		})
+	}
+
+	/** Own comments **/
+	// GET the current text of a comment of the user that can still be edited
+	auth.GET("/item/:id/edit", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
+		session, ok := hnSession(c)
+		if !ok {
+			return
+		}
+		text, err := session.EditText(c.Request.Context(), id)
+		if err != nil {
+			actionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id, "text": text})
+	})
+
+	auth.POST("/item/:id/edit", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
+		var req EditRequest
+		session, ok := api.actionParams(c, &req)
+		if !ok {
+			return
+		}
+		story, err := session.Edit(c.Request.Context(), id, req.Text)
+		if err != nil {
+			actionError(c, err)
+			return
+		}
+		api.refreshThread(story)
+		c.JSON(http.StatusOK, gin.H{"id": id, "story": story})
+	})
+
+	auth.POST("/item/:id/delete", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
+		session, ok := hnSession(c)
+		if !ok {
+			return
+		}
+		story, err := session.Delete(c.Request.Context(), id)
+		if err != nil {
+			actionError(c, err)
+			return
+		}
+		api.refreshThread(story)
+		c.JSON(http.StatusOK, gin.H{"id": id, "story": story})
+	})
+
+	/** Lists of the user **/
+	// GET the stories, or the comments with comments=true, the user has favorited
+	auth.GET("/me/favorites", func(c *gin.Context) {
+		var query PageQuery
+		if !bindQuery(c, &query) {
+			return
+		}
+		session, ok := hnSession(c)
+		if !ok {
+			return
+		}
+		if query.Comments {
+			comments, err := session.FavoriteComments(c.Request.Context(), query.page())
+			if err != nil {
+				actionError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"values": comments, "page": query.page()})
+			return
+		}
+		news, err := session.FavoriteNews(c.Request.Context(), query.page())
+		if err != nil {
+			actionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"values": news, "page": query.page()})
+	})
+
+	// GET the stories the user has hidden
+	auth.GET("/me/hidden", func(c *gin.Context) {
+		var query PageQuery
+		if !bindQuery(c, &query) {
+			return
+		}
+		session, ok := hnSession(c)
+		if !ok {
+			return
+		}
+		news, err := session.HiddenNews(c.Request.Context(), query.page())
+		if err != nil {
+			actionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"values": news, "page": query.page()})
+	})
+}
+
+// Returns the id of the item in the path
+func idParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		failMessage(c, "bad_request", "Invalid item id", nil)
+		return 0, false
+	}
+	return id, true
+}
+
+// Scrapes the thread of the story again in the background so that
+// /v1/comments shows the change right away instead of after the next scrape
+// cycle. Gives up after hn.RetryTimeout, or as soon as the API stops.
+func (api *API) refreshThread(story int) {
+	if api.ReadOnly {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(api.ctx, hn.RetryTimeout)
+		defer cancel()
+		if err := scraper.RefreshComments(ctx, int32(story)); err != nil {
+			log.Println("Refresh:", err)
+		}
+	}()
+}
+
+// Binds the body of an action to req and resumes the Session on Hacker News,
+// responds with an error and returns false if either fails.
+func (api *API) actionParams(c *gin.Context, req interface{}) (*hn.Session, bool) {
+	if err := api.bindBody(c, req); err != nil {
+		failValidation(c, err)
+		return nil, false
+	}
+	return hnSession(c)
+}
+
+// Queues the action in the outbox of the user if it failed because Hacker
+// News is throttling or unavailable, otherwise responds with the error. The
+// failed attempt counts, so the action waits out a backoff before it is retried.
+func (api *API) queueOrFail(c *gin.Context, err error, action services.OutboxAction) {
+	if !hn.Temporary(err) {
+		actionError(c, err)
+		return
+	}
+	action.Attempts = 1
+	if api.Outbox != nil {
+		action.NextAttempt = time.Now().Add(api.Outbox.Backoff(action.Attempts))
+	}
+	queueAction(c, action, ErrorCode(err))
+}
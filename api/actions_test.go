@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"hnews/hn"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestItemActions(t *testing.T) {
+	// Story 5 as seen by a user who has favorited, hidden, flagged and voted on it
+	var followed string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/item" {
+			fmt.Fprint(w, `<html><body><table><tr class="athing" id="5"><td>
+<a href="vote?id=5&how=un&auth=a">unvote</a> <a href="fave?id=5&un=t&auth=a">un-favorite</a>
+<a href="hide?id=5&un=t&auth=a">un-hide</a> <a href="flag?id=5&un=t&auth=a">unflag</a>
+</td></tr></table></body></html>`)
+			return
+		}
+		followed = r.URL.Path + "?" + r.URL.RawQuery
+		http.Redirect(w, r, "/item?id=5", http.StatusFound)
+	}))
+	defer server.Close()
+	base := hn.BaseURL
+	hn.BaseURL = server.URL + "/"
+	defer func() { hn.BaseURL = base }()
+	session, err := hn.Resume("alice", "alice&token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		action  string
+		want    string // The action link followed
+		wantErr error
+	}{
+		{"favorite", "", hn.ErrUnavailableAction},
+		{"unfavorite", "/fave?id=5&un=t&auth=a", nil},
+		{"hide", "", hn.ErrUnavailableAction},
+		{"unhide", "/hide?id=5&un=t&auth=a", nil},
+		{"flag", "", hn.ErrUnavailableAction},
+		{"unflag", "/flag?id=5&un=t&auth=a", nil},
+		{"unvote", "/vote?id=5&how=un&auth=a", nil},
+	}
+	if len(tests) != len(itemActions) {
+		t.Errorf("%d item actions, want %d", len(itemActions), len(tests))
+	}
+	for _, test := range tests {
+		action, ok := itemActions[test.action]
+		if !ok {
+			t.Errorf("no item action %q", test.action)
+			continue
+		}
+		followed = ""
+		if err := action(session, context.Background(), 5); err != test.wantErr || followed != test.want {
+			t.Errorf("%s = %v following %q, want %v following %q", test.action, err, followed, test.wantErr, test.want)
+		}
+	}
+}
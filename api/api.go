@@ -1,225 +1,329 @@
 package api
 
-// TODO: Start documenting the error codes to the frontend.
-// TODO: Disable debug mode in Sinatra
-
 import (
+	"context"
+	"hnews/enrich"
+	"hnews/outbox"
+	"hnews/ranking"
 	"hnews/scraper"
 	"hnews/services"
-	"io/ioutil"
-	"log"
+	"hnews/session"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // API has a pointer to each of the resource DatabaseServices
 type API struct {
-	TopEndpoint    scraper.Resource
-	AskEndpoint    scraper.Resource
-	ShowEndpoint   scraper.Resource
-	NewestEndpoint scraper.Resource
+	Resources  []scraper.Resource  // Lists served at /v1 + their URL
+	Ranking    *ranking.Engine     // Ranks News by our own velocity data
+	Thumbnails *enrich.Thumbnailer // Generates and stores the thumbnails of News, optional
+	Sessions   *session.Store      // Sessions of the logged in users
+	Outbox     *outbox.Worker      // Delivers the queued actions, optional
+
+	LegacyQueryAuth bool          // Deprecated: Accept API keys and write payloads in the query string
+	MaxLimit        int           // Longest page of a list, defaults to 100
+	Port            string        // Port to listen on, defaults to 8080
+	ShutdownTimeout time.Duration // Most time the requests in progress get to finish on shutdown, defaults to 30s
+	ReadOnly        bool          // The lists are read-only snapshots, so the API leaves them to the scraper
+
+	ctx   context.Context // Done once the API stops
+	votes *voteCache      // What the logged in users have voted on
+}
+
+// RangeQuery is the query of a page of the ranked lists, either :limit:
+// items from the :cursor: of the previous page or the ranks from :from: to :to:
+type RangeQuery struct {
+	From   int    `form:"from" binding:"omitempty,min=1"`
+	To     int    `form:"to" binding:"omitempty,min=1,gtefield=From"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1"`
+}
+
+// ListQuery is the query of /v1/top, /v1/ask, /v1/show and /v1/newest
+type ListQuery struct {
+	RangeQuery
+	At string `form:"at"` // Time travel to the snapshot taken at or before this time
+}
+
+// CommentsQuery is the query of /v1/comments
+type CommentsQuery struct {
+	RangeQuery
+	NewsID int `form:"newsid" binding:"required,min=1"`
+}
+
+// HistoryQuery is the query of /v1/item/:id/history
+type HistoryQuery struct {
+	Since int64 `form:"since" binding:"min=0"` // Unix time
 }
 
-// StartAPI sets up the API and starts it on Heroku port or :8080
-func (api *API) StartAPI(debug bool) {
+// StartAPI sets up the API and serves it on Heroku port or :8080 until ctx is
+// done, then stops accepting requests and returns once the ones in progress
+// have finished or ShutdownTimeout has passed.
+func (api *API) StartAPI(ctx context.Context, debug bool) error {
 	if debug {
 		gin.SetMode(gin.DebugMode)
 	} else {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	r := gin.Default()
+	r.Use(api.respondError)
+	r.NoRoute(func(c *gin.Context) {
+		fail(c, "not_found", nil)
+	})
+	r.HandleMethodNotAllowed = true
+	r.NoMethod(func(c *gin.Context) {
+		fail(c, "method_not_allowed", nil)
+	})
+	api.ctx = ctx
+	api.votes = newVoteCache(ctx)
+	if api.MaxLimit <= 0 {
+		api.MaxLimit = 100
+	}
 
-	// GET TOP posts from index :from: to index :to:
-	r.GET("/v1/top", func(c *gin.Context) {
-		from, err0 := strconv.Atoi(c.Query("from"))
-		to, err1 := strconv.Atoi(c.Query("to"))
-		if err0 != nil || err1 != nil || from <= 0 {
-			c.String(http.StatusBadRequest, "Bad index")
-			return
-		}
-
-		news := api.TopEndpoint.BackingStore.ReadNews(from, to)
-		c.JSON(http.StatusOK, gin.H{"values": news})
+	// GET the catalog of the error codes the API answers with
+	r.GET("/v1/errors", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"values": errorCatalog})
 	})
 
-	// GET ASK posts from index :from: to index :to:
-	r.GET("/v1/ask", func(c *gin.Context) {
-		from, err0 := strconv.Atoi(c.Query("from"))
-		to, err1 := strconv.Atoi(c.Query("to"))
-		if err0 != nil || err1 != nil || from <= 0 {
-			c.String(http.StatusBadRequest, "Bad index")
+	// GET a page of the posts of each of the lists, e.g. /v1/top
+	for _, resource := range api.Resources {
+		r.GET("/v1"+resource.URL, api.identify, api.listHandler(resource))
+	}
+	api.resourceRoutes(r)
+
+	// GET TRENDING posts from index :from: to index :to: ranked by velocity
+	r.GET("/v1/trending", func(c *gin.Context) {
+		var query RangeQuery
+		if !bindQuery(c, &query) {
 			return
 		}
-
-		news := api.AskEndpoint.BackingStore.ReadNews(from, to)
-		c.JSON(http.StatusOK, gin.H{"values": news})
-	})
-
-	// GET SHOw.URL posts from index :from: to index :to:
-	r.GET("/v1/show", func(c *gin.Context) {
-		from, err0 := strconv.Atoi(c.Query("from"))
-		to, err1 := strconv.Atoi(c.Query("to"))
-		if err0 != nil || err1 != nil || from <= 0 {
-			c.String(http.StatusBadRequest, "Bad index")
+		cur, limit, ok := api.readPage(c, "trending", query)
+		if !ok {
 			return
 		}
 
-		news := api.ShowEndpoint.BackingStore.ReadNews(from, to)
-		c.JSON(http.StatusOK, gin.H{"values": news})
+		news := api.Ranking.Trending(cur.Offset+1, cur.Offset+limit)
+		total, _, computed := api.Ranking.Totals()
+		respondPage(c, news, cur, limit, total, computed)
 	})
 
-	// GET NEWEST posts from index :from: to index :to:
-	r.GET("/v1/newest", func(c *gin.Context) {
-		from, err0 := strconv.Atoi(c.Query("from"))
-		to, err1 := strconv.Atoi(c.Query("to"))
-		if err0 != nil || err1 != nil || from <= 0 {
-			c.String(http.StatusBadRequest, "Bad index")
+	// GET RISING posts from index :from: to index :to:, young posts off the front page
+	r.GET("/v1/rising", func(c *gin.Context) {
+		var query RangeQuery
+		if !bindQuery(c, &query) {
+			return
+		}
+		cur, limit, ok := api.readPage(c, "rising", query)
+		if !ok {
 			return
 		}
 
-		news := api.NewestEndpoint.BackingStore.ReadNews(from, to)
-		c.JSON(http.StatusOK, gin.H{"values": news})
+		news := api.Ranking.Rising(cur.Offset+1, cur.Offset+limit)
+		_, total, computed := api.Ranking.Totals()
+		respondPage(c, news, cur, limit, total, computed)
 	})
 
 	/** Comment Endpoint **/
 	// Gives the comments from a i to j given the provided news id.
-	r.GET("/v1/comments", func(c *gin.Context) {
-		from, err0 := strconv.Atoi(c.Query("from"))
-		to, err1 := strconv.Atoi(c.Query("to"))
-		if err0 != nil || err1 != nil || from <= 0 {
-			c.String(http.StatusBadRequest, "Bad index")
+	r.GET("/v1/comments", api.identify, func(c *gin.Context) {
+		var query CommentsQuery
+		if !bindQuery(c, &query) {
 			return
 		}
-
-		id, err := strconv.Atoi(c.Query("newsid"))
-		if err != nil {
-			c.String(http.StatusBadRequest, "Not a valid item id")
+		// Unlike the ranks of the lists, the comments always stopped before 'to'
+		rangeQuery, empty := excludeTo(query.RangeQuery)
+		if empty {
+			c.JSON(http.StatusOK, gin.H{"values": []services.Comment{}, "next": nil, "total": services.CountComments(query.NewsID), "fetched_at": nil})
+			return
+		}
+		cur, limit, ok := api.readPage(c, "comments/"+strconv.Itoa(query.NewsID), rangeQuery)
+		if !ok {
 			return
 		}
 
-		comments := services.ReadComments(id, from, to)
-		c.JSON(http.StatusOK, gin.H{"values": comments})
+		// Comments are numbered from 1 and read up to but not including to
+		comments := services.ReadComments(query.NewsID, cur.Offset+1, cur.Offset+limit+1)
+		if comments == nil {
+			comments = []services.Comment{}
+		}
+		api.annotateComments(c, query.NewsID, comments)
+		respondPage(c, comments, cur, limit, services.CountComments(query.NewsID), time.Time{})
 	})
 
-	/** Login wrapper for login-service **/
-	r.POST("/v1/login", func(c *gin.Context) {
-		username := c.Query("username")
-		password := c.Query("password")
-
-		url := "http://localhost:3000/v1/login"
-		req, _ := http.NewRequest("POST", url, nil)
-
-		values := req.URL.Query()
-		values.Add("username", username)
-		values.Add("password", password)
-		req.URL.RawQuery = values.Encode()
+	/** Archive Endpoint **/
+	// GET the front page as it was on :date: formatted as 2006-01-02
+	r.GET("/v1/front/:date", func(c *gin.Context) {
+		day := c.Param("date")
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			failMessage(c, "bad_request", "Bad date, use 2006-01-02", nil)
+			return
+		}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err == nil {
-			defer resp.Body.Close()
-			content, _ := ioutil.ReadAll(resp.Body)
-			c.JSON(resp.StatusCode, string(content))
+		news := services.ReadFront(day)
+		if news == nil {
+			fail(c, "not_archived", nil)
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{"values": news})
 	})
 
-	/** Entry wrapper for login-service **/
-	r.POST("/v1/login/entry/upvote", func(c *gin.Context) {
-		id := c.Query("id")
-		apikey := c.Query("apikey")
-
-		url := "http://localhost:3000/v1/login/entry/upvote"
-		req, _ := http.NewRequest("POST", url, nil)
+	/** Thumbnail Endpoint **/
+	// Gives the thumbnail of the preview image of a news item as JPEG
+	r.GET("/v1/item/:id/thumbnail", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
 
-		values := req.URL.Query()
-		values.Add("id", id)
-		values.Add("apikey", apikey)
-		req.URL.RawQuery = values.Encode()
+		// Without a Thumbnailer there is nowhere to serve the thumbnails from
+		thumbnail, ok := services.ReadThumbnail(id)
+		if !ok || thumbnail.Hash == "" || api.Thumbnails == nil {
+			fail(c, "no_thumbnail", nil)
+			return
+		}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err == nil {
-			defer resp.Body.Close()
-			content, _ := ioutil.ReadAll(resp.Body)
-			c.JSON(resp.StatusCode, string(content))
+		// Thumbnails are content-addressed so the hash makes a strong ETag
+		etag := `"` + thumbnail.Hash + `"`
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "public, max-age=86400")
+		if c.Request.Header.Get("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
 		}
+		c.File(api.Thumbnails.Path(thumbnail.Hash))
 	})
 
-	r.POST("/v1/login/entry/comment", func(c *gin.Context) {
-		id := c.Query("id")
-		comment := c.Query("comment")
-		apikey := c.Query("apikey")
-
-		url := "http://localhost:3000/v1/login/entry/comment"
-		req, _ := http.NewRequest("POST", url, nil)
-
-		values := req.URL.Query()
-		values.Add("id", id)
-		values.Add("comment", comment)
-		values.Add("apikey", apikey)
-		req.URL.RawQuery = values.Encode()
-
-		resp, err := http.DefaultClient.Do(req)
-		if err == nil {
-			defer resp.Body.Close()
-			content, _ := ioutil.ReadAll(resp.Body)
-			c.JSON(resp.StatusCode, string(content))
+	/** History Endpoint **/
+	// Gives the Samples of a news item, optionally only those taken after the unix time :since:
+	r.GET("/v1/item/:id/history", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
 		}
-	})
 
-	/** Comment wrapper for login-service **/
-	r.POST("/v1/login/comment/upvote", func(c *gin.Context) {
-		id := c.Query("id")
-		apikey := c.Query("apikey")
+		var query HistoryQuery
+		if !bindQuery(c, &query) {
+			return
+		}
+		var since time.Time
+		if query.Since > 0 {
+			since = time.Unix(query.Since, 0)
+		}
 
-		url := "http://localhost:3000/v1/login/comment/upvote"
-		req, _ := http.NewRequest("POST", url, nil)
+		history := services.ReadHistory(id, since)
+		c.JSON(http.StatusOK, gin.H{"values": history})
+	})
 
-		values := req.URL.Query()
-		values.Add("id", id)
-		values.Add("apikey", apikey)
-		req.URL.RawQuery = values.Encode()
+	/** Article Endpoint **/
+	// Gives the main content of the page a news item links to for offline reading
+	r.GET("/v1/item/:id/article", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err == nil {
-			defer resp.Body.Close()
-			content, _ := ioutil.ReadAll(resp.Body)
-			c.JSON(resp.StatusCode, string(content))
+		article, ok := services.ReadArticle(id)
+		if !ok {
+			fail(c, "not_extracted", nil)
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{"values": article})
 	})
 
-	r.POST("/v1/login/commment/reply", func(c *gin.Context) {
-		id := c.Query("id")
-		reply := c.Query("reply")
-		apikey := c.Query("apikey")
+	/** Logged in users **/
+	// Everything in auth requires the API key of a session in the Authorization header
+	auth := r.Group("/v1", api.authenticate)
+	api.sessionRoutes(r, auth)
+	api.actionRoutes(auth)
+	api.notificationRoutes(auth)
+	api.outboxRoutes(auth)
+	api.bookmarkRoutes(auth)
+	api.readRoutes(auth)
+
+	if api.Port == "" {
+		api.Port = "8080"
+	}
+	if api.ShutdownTimeout <= 0 {
+		api.ShutdownTimeout = 30 * time.Second
+	}
+	server := &http.Server{Addr: ":" + api.Port, Handler: r}
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		timeout, cancel := context.WithTimeout(context.Background(), api.ShutdownTimeout)
+		defer cancel()
+		shutdown <- server.Shutdown(timeout)
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return <-shutdown
+}
 
-		url := "http://localhost:3000/v1/login/comment/reply"
-		req, _ := http.NewRequest("POST", url, nil)
+// Layouts accepted for the time travelling 'at' parameter
+var atLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02T15:04", "2006-01-02"}
+
+// Returns a handler responding with a page of the latest snapshot of the
+// list, or of the snapshot taken at or before :at:. Later pages are read from
+// the same snapshot as the first one so that no News is skipped or repeated
+// while the list changes.
+func (api *API) listHandler(resource scraper.Resource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query ListQuery
+		if !bindQuery(c, &query) {
+			return
+		}
+		cur, limit, ok := api.readPage(c, resource.Name, query.RangeQuery)
+		if !ok {
+			return
+		}
 
-		values := req.URL.Query()
-		values.Add("id", id)
-		values.Add("reply", reply)
-		values.Add("apikey", apikey)
-		req.URL.RawQuery = values.Encode()
+		at := time.Now()
+		if cur.At != 0 {
+			at = time.Unix(0, cur.At)
+		} else if query.At != "" {
+			if at, ok = parseAt(c, query.At); !ok {
+				return
+			}
+			cur.Past = true
+		}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err == nil {
-			defer resp.Body.Close()
-			content, _ := ioutil.ReadAll(resp.Body)
-			c.JSON(resp.StatusCode, string(content))
+		taken, news, total := services.ReadSnapshotPage(resource.Name, at, cur.Offset, limit)
+		if taken.IsZero() {
+			if cur.At != 0 || query.At != "" {
+				fail(c, "not_archived", nil)
+				return
+			}
+			// Nothing archived yet, read the list as last scraped
+			news = resource.BackingStore.ReadNews(cur.Offset+1, cur.Offset+limit)
+			total = resource.BackingStore.CountNews()
+		} else {
+			cur.At = taken.UnixNano()
+		}
+		if news == nil {
+			news = []services.News{}
 		}
-	})
 
-	r.Run(":" + getPort()) // listen and serve on 0.0.0.0:8080
+		// What the user votes on now has nothing to do with a list of the past
+		if !cur.Past {
+			api.annotateNews(c, resource, cur.Offset+1, cur.Offset+limit, news)
+		}
+		respondPage(c, news, cur, limit, total, taken)
+	}
 }
 
-// Tries to get Heroku port otherwise return default 8080
-func getPort() string {
-	port := os.Getenv("PORT")
-	log.Println(port)
-	if port != "" {
-		return port
+// Parses the time travelling 'at' parameter
+func parseAt(c *gin.Context, value string) (time.Time, bool) {
+	var at time.Time
+	var err error
+	for _, layout := range atLayouts {
+		if at, err = time.Parse(layout, value); err == nil {
+			return at, true
+		}
 	}
-	return "8080"
+	failMessage(c, "bad_request", "Bad time, use RFC 3339", gin.H{"at": value})
+	return at, false
 }
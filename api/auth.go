@@ -0,0 +1,93 @@
+package api
+
+import (
+	"hnews/session"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Query parameters that must never be sent in the URL unless LegacyQueryAuth
+var secretParams = []string{"apikey", "username", "password", "comment", "reply"}
+
+// Middleware looking up the Session of the API key in the Authorization
+// header, "Bearer <apikey>", and aborting with 401 if there is none.
+func (api *API) authenticate(c *gin.Context) {
+	if !api.rejectQueryPayload(c) {
+		return
+	}
+
+	apikey := strings.TrimSpace(strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "))
+	if apikey == "" && api.LegacyQueryAuth {
+		apikey = c.Query("apikey")
+		deprecated(c)
+	}
+
+	s, err := api.Sessions.Get(apikey)
+	switch err {
+	case nil:
+		c.Set("apikey", apikey)
+		c.Set("session", s)
+		c.Next()
+	case session.ErrExpired:
+		fail(c, "session_expired", nil)
+	default:
+		fail(c, "not_logged_in", nil)
+	}
+}
+
+// Returns the Session set by authenticate
+func currentSession(c *gin.Context) *session.Session {
+	return c.MustGet("session").(*session.Session)
+}
+
+// Responds with 400 and returns false if secrets are passed in the query
+// string and LegacyQueryAuth is not enabled.
+func (api *API) rejectQueryPayload(c *gin.Context) bool {
+	if api.LegacyQueryAuth {
+		return true
+	}
+	query := c.Request.URL.Query()
+	for _, param := range secretParams {
+		if _, ok := query[param]; ok {
+			failMessage(c, "secret_in_query", "Pass "+param+" in the body or Authorization header, not the query string", nil)
+			return false
+		}
+	}
+	return true
+}
+
+// Binds the JSON or form body of the request to obj and validates it. The
+// query string is only used with LegacyQueryAuth. Unlike c.BindWith nothing
+// is written on failure, that is up to the caller.
+func (api *API) bindBody(c *gin.Context, obj interface{}) error {
+	switch {
+	case c.ContentType() == binding.MIMEJSON:
+		return binding.JSON.Bind(c.Request, obj)
+	case c.ContentType() == binding.MIMEMultipartPOSTForm:
+		return binding.FormMultipart.Bind(c.Request, obj)
+	case api.LegacyQueryAuth:
+		if len(c.Request.URL.RawQuery) > 0 {
+			deprecated(c)
+		}
+		return binding.Form.Bind(c.Request, obj)
+	default:
+		return binding.FormPost.Bind(c.Request, obj)
+	}
+}
+
+// Binds the query string of the request to the typed query obj and validates
+// it by its binding tags, aborts with 400 and returns false if it is invalid.
+func bindQuery(c *gin.Context, obj interface{}) bool {
+	if err := binding.Form.Bind(c.Request, obj); err != nil {
+		failValidation(c, err)
+		return false
+	}
+	return true
+}
+
+// Warns the client that it uses the deprecated query string style
+func deprecated(c *gin.Context) {
+	c.Header("Warning", `299 - "Passing the API key and payloads in the query string is deprecated"`)
+}
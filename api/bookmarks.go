@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"hnews/hn"
+	"hnews/scraper"
+	"hnews/services"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BookmarkRequest is the body of /v1/me/bookmarks
+type BookmarkRequest struct {
+	ID   int      `form:"id" json:"id" binding:"required"`
+	Tags []string `form:"tags" json:"tags"`
+	Note string   `form:"note" json:"note" binding:"max=2000"`
+}
+
+// BookmarkUpdate is the body of PUT /v1/me/bookmarks/:id
+type BookmarkUpdate struct {
+	Tags []string `form:"tags" json:"tags"`
+	Note string   `form:"note" json:"note" binding:"max=2000"`
+}
+
+// Sets up the routes of the stories saved by the logged in user
+func (api *API) bookmarkRoutes(auth *gin.RouterGroup) {
+	// GET the bookmarks of the user, latest saved first, only those tagged :tag: if given
+	auth.GET("/me/bookmarks", func(c *gin.Context) {
+		s := currentSession(c)
+		c.JSON(http.StatusOK, gin.H{"values": services.ReadBookmarks(s.Username, c.Query("tag"))})
+	})
+
+	auth.GET("/me/bookmarks/:id", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
+		bookmark, ok := services.ReadBookmark(currentSession(c).Username, id)
+		if !ok {
+			fail(c, "bookmark_not_found", nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"values": bookmark})
+	})
+
+	// Bookmarks a story, bookmarking it again replaces the tags and note
+	auth.POST("/me/bookmarks", func(c *gin.Context) {
+		var req BookmarkRequest
+		if err := api.bindBody(c, &req); err != nil {
+			failValidation(c, err)
+			return
+		}
+		username := currentSession(c).Username
+
+		bookmark, ok := services.ReadBookmark(username, req.ID)
+		if !ok {
+			news, ok := services.LatestNews(req.ID)
+			if !ok {
+				// Hacker News may be busy for a while, the user won't wait that long
+				ctx, cancel := context.WithTimeout(c.Request.Context(), hn.RetryTimeout)
+				var err error
+				news, err = scraper.FetchNews(ctx, int32(req.ID))
+				cancel()
+				if err == scraper.ErrNoNews {
+					fail(c, "item_not_found", nil)
+					return
+				}
+				if err != nil {
+					log.Println("Bookmark:", err)
+					failMessage(c, "upstream_error", "Could not fetch the story from Hacker News", nil)
+					return
+				}
+			}
+			bookmark = services.Bookmark{ID: int32(req.ID), SavedAt: time.Now(), News: services.BookmarkedNews(news)}
+		}
+		bookmark.Tags = req.Tags
+		bookmark.Note = req.Note
+		api.saveBookmark(c, username, bookmark)
+	})
+
+	auth.PUT("/me/bookmarks/:id", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
+		var req BookmarkUpdate
+		if err := api.bindBody(c, &req); err != nil {
+			failValidation(c, err)
+			return
+		}
+		username := currentSession(c).Username
+		bookmark, ok := services.ReadBookmark(username, id)
+		if !ok {
+			fail(c, "bookmark_not_found", nil)
+			return
+		}
+		bookmark.Tags = req.Tags
+		bookmark.Note = req.Note
+		api.saveBookmark(c, username, bookmark)
+	})
+
+	auth.DELETE("/me/bookmarks/:id", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
+		if !services.DeleteBookmark(currentSession(c).Username, id) {
+			fail(c, "bookmark_not_found", nil)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+}
+
+// Stores the bookmark and responds with it
+func (api *API) saveBookmark(c *gin.Context, username string, bookmark services.Bookmark) {
+	if bookmark.Tags == nil {
+		bookmark.Tags = []string{}
+	}
+	if err := services.SaveBookmark(username, bookmark); err != nil {
+		log.Println("Bookmark:", err)
+		failMessage(c, "internal_error", "Could not save the bookmark", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"values": bookmark})
+}
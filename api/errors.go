@@ -0,0 +1,188 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"hnews/hn"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/validator.v8"
+)
+
+// An error code documented to the clients, see GET /v1/errors
+type catalogEntry struct {
+	Code    string `json:"code"`
+	Status  int    `json:"status"`
+	Message string `json:"message"` // Default message of the errors with the code
+}
+
+// The catalog of all the error codes the API answers with
+var errorCatalog = []catalogEntry{
+	{"bad_request", http.StatusBadRequest, "Missing or invalid parameters"},
+	{"secret_in_query", http.StatusBadRequest, "API key or payload passed in the query string"},
+	{"invalid_cursor", http.StatusBadRequest, "The cursor is malformed or belongs to another list"},
+	{"empty_comment", http.StatusBadRequest, "Empty comment"},
+	{"not_logged_in", http.StatusUnauthorized, "Not logged in"},
+	{"session_expired", http.StatusUnauthorized, "Session expired"},
+	{"not_editable", http.StatusForbidden, "The comment is not yours or can no longer be edited"},
+	{"not_found", http.StatusNotFound, "No such endpoint"},
+	{"bad_login", http.StatusNotFound, "Bad username or password"},
+	{"item_not_found", http.StatusNotFound, "Item not found"},
+	{"not_archived", http.StatusNotFound, "The list was not archived at that time"},
+	{"not_extracted", http.StatusNotFound, "The article has not been extracted"},
+	{"no_thumbnail", http.StatusNotFound, "The story has no thumbnail"},
+	{"session_not_found", http.StatusNotFound, "No session of the user with the id"},
+	{"bookmark_not_found", http.StatusNotFound, "The story is not bookmarked"},
+	{"action_not_found", http.StatusNotFound, "No pending action in the outbox with the id"},
+	{"method_not_allowed", http.StatusMethodNotAllowed, "Method not allowed"},
+	{"cannot_vote", http.StatusConflict, "Cannot vote on item"},
+	{"action_unavailable", http.StatusConflict, "The action is not available on the item"},
+	{"duplicate_url", http.StatusConflict, "The url has already been submitted"},
+	{"submission_rejected", http.StatusUnprocessableEntity, "Hacker News rejected the submission"},
+	{"posting_too_fast", http.StatusTooManyRequests, "Hacker News says we are posting too fast"},
+	{"internal_error", http.StatusInternalServerError, "Internal error"},
+	{"upstream_error", http.StatusBadGateway, "Unexpected response from Hacker News"},
+	{"upstream_unavailable", http.StatusServiceUnavailable, "Hacker News is unavailable"},
+	{"upstream_timeout", http.StatusGatewayTimeout, "Hacker News did not respond in time"},
+}
+
+// The error codes of the errors of the actions on Hacker News
+var actionFailures = map[error]string{
+	hn.ErrBadLogin:          "bad_login",
+	hn.ErrNotFound:          "item_not_found",
+	hn.ErrCannotVote:        "cannot_vote",
+	hn.ErrUnavailableAction: "action_unavailable",
+	hn.ErrNotEditable:       "not_editable",
+	hn.ErrEmptyComment:      "empty_comment",
+	hn.ErrTooFast:           "posting_too_fast",
+	hn.ErrDuplicate:         "duplicate_url",
+	hn.ErrRejected:          "submission_rejected",
+	hn.ErrUnexpected:        "upstream_error",
+	hn.ErrUnavailable:       "upstream_unavailable",
+	hn.ErrTimeout:           "upstream_timeout",
+}
+
+// apiError is a failure answered with the error envelope by respondError
+type apiError struct {
+	catalogEntry
+	Details interface{}
+}
+
+func (err *apiError) Error() string {
+	return err.Code + ": " + err.Message
+}
+
+// A parameter that failed validation
+type invalidField struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// Returns the catalog entry of the code, an internal error if it is not documented
+func lookupCode(code string) catalogEntry {
+	for _, entry := range errorCatalog {
+		if entry.Code == code {
+			return entry
+		}
+	}
+	log.Println("Undocumented error code:", code)
+	return lookupCode("internal_error")
+}
+
+// Aborts the request with the error code and its default message, the
+// details are passed along to the client as is
+func fail(c *gin.Context, code string, details interface{}) {
+	failMessage(c, code, "", details)
+}
+
+// Like fail but with a message other than the default of the code
+func failMessage(c *gin.Context, code string, message string, details interface{}) {
+	err := &apiError{lookupCode(code), details}
+	if message != "" {
+		err.Message = message
+	}
+	c.Error(err)
+	c.Abort()
+}
+
+// Aborts the request with 400 and the parameters that failed validation
+func failValidation(c *gin.Context, err error) {
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		failMessage(c, "bad_request", err.Error(), nil)
+		return
+	}
+	var fields []invalidField
+	for _, fieldErr := range errs {
+		fields = append(fields, invalidField{strings.ToLower(fieldErr.Field), fieldErr.Tag, strings.ToLower(fieldErr.Param)})
+	}
+	sort.Sort(byField(fields))
+	fail(c, "bad_request", fields)
+}
+
+// Aborts the request with the error code matching the error of an action on Hacker News
+func actionError(c *gin.Context, err error) {
+	code, ok := actionFailures[err]
+	if !ok {
+		log.Println("Action:", err)
+		code = "upstream_error"
+	}
+	fail(c, code, nil)
+}
+
+// ErrorCode returns the documented error code of an error of an action on Hacker News.
+func ErrorCode(err error) string {
+	if code, ok := actionFailures[err]; ok {
+		return code
+	}
+	return "upstream_error"
+}
+
+// Middleware giving every request an id and answering every failure with
+// the error envelope: code, message, details and request_id.
+func (api *API) respondError(c *gin.Context) {
+	requestID := c.Request.Header.Get("X-Request-ID")
+	if requestID == "" || len(requestID) > 64 {
+		requestID = newRequestID()
+	}
+	c.Set("request_id", requestID)
+	c.Header("X-Request-ID", requestID)
+
+	c.Next()
+
+	if c.Writer.Written() || len(c.Errors) == 0 {
+		return
+	}
+	var failure *apiError
+	switch err := c.Errors.Last().Err.(type) {
+	case *apiError:
+		failure = err
+	default:
+		log.Println("API:", err)
+		failure = &apiError{lookupCode("internal_error"), nil}
+	}
+	c.JSON(failure.Status, gin.H{
+		"code":       failure.Code,
+		"message":    failure.Message,
+		"details":    failure.Details,
+		"request_id": requestID,
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sorts invalid fields by name so that the details are stable
+type byField []invalidField
+
+func (fields byField) Len() int           { return len(fields) }
+func (fields byField) Swap(i, j int)      { fields[i], fields[j] = fields[j], fields[i] }
+func (fields byField) Less(i, j int) bool { return fields[i].Field < fields[j].Field }
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"hnews/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationsQuery is the query of /v1/me/notifications
+type NotificationsQuery struct {
+	Unread bool `form:"unread"` // Only the unread notifications
+}
+
+// ReadRequest is the body of /v1/me/notifications/read, no ids marks all as read
+type ReadRequest struct {
+	IDs []int32 `form:"ids" json:"ids"`
+}
+
+// Sets up the routes of the replies to the logged in user
+func (api *API) notificationRoutes(auth *gin.RouterGroup) {
+	// GET the replies to the user, newest first, only the unread with unread=true
+	auth.GET("/me/notifications", func(c *gin.Context) {
+		s := currentSession(c)
+		var query NotificationsQuery
+		if !bindQuery(c, &query) {
+			return
+		}
+		notifications, unread := services.ReadNotifications(s.Username, query.Unread)
+		c.JSON(http.StatusOK, gin.H{"values": notifications, "unread": unread})
+	})
+
+	auth.POST("/me/notifications/read", func(c *gin.Context) {
+		var req ReadRequest
+		if c.Request.ContentLength != 0 {
+			if err := api.bindBody(c, &req); err != nil {
+				failValidation(c, err)
+				return
+			}
+		}
+		s := currentSession(c)
+		services.MarkNotificationsRead(s.Username, req.IDs)
+		_, unread := services.ReadNotifications(s.Username, true)
+		c.JSON(http.StatusOK, gin.H{"unread": unread})
+	})
+}
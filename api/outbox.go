@@ -0,0 +1,93 @@
+package api
+
+import (
+	"hnews/outbox"
+	"hnews/services"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OutboxRequest is the body of /v1/me/outbox, the fields needed depend on the kind
+type OutboxRequest struct {
+	Kind  string `form:"kind" json:"kind" binding:"required"`
+	ID    int    `form:"id" json:"id"`
+	Title string `form:"title" json:"title" binding:"max=80"`
+	URL   string `form:"url" json:"url" binding:"omitempty,url"`
+	Text  string `form:"text" json:"text"`
+}
+
+// Sets up the routes of the actions queued for delivery to Hacker News
+func (api *API) outboxRoutes(auth *gin.RouterGroup) {
+	// GET the queued actions of the user, newest first
+	auth.GET("/me/outbox", func(c *gin.Context) {
+		s := currentSession(c)
+		c.JSON(http.StatusOK, gin.H{"values": services.ReadOutbox(s.Username)})
+	})
+
+	// Queues an action without trying it first, e.g. when the app was offline
+	auth.POST("/me/outbox", func(c *gin.Context) {
+		var req OutboxRequest
+		if err := api.bindBody(c, &req); err != nil {
+			failValidation(c, err)
+			return
+		}
+		action := services.OutboxAction{Kind: req.Kind, Item: req.ID, Title: req.Title, URL: req.URL, Text: req.Text}
+		if message := validateAction(action); message != "" {
+			failMessage(c, "bad_request", message, nil)
+			return
+		}
+		queueAction(c, action, "")
+	})
+
+	// Cancels a pending action
+	auth.DELETE("/me/outbox/:id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			failMessage(c, "bad_request", "Invalid action id", nil)
+			return
+		}
+		if err := services.CancelAction(currentSession(c).Username, id); err != nil {
+			fail(c, "action_not_found", nil)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+}
+
+// Returns what is wrong with the action, or empty if it can be queued
+func validateAction(action services.OutboxAction) string {
+	switch action.Kind {
+	case outbox.Upvote:
+		if action.Item <= 0 {
+			return "Missing id"
+		}
+	case outbox.Comment, outbox.Reply:
+		if action.Item <= 0 || action.Text == "" {
+			return "Missing id or text"
+		}
+	case outbox.Submit:
+		if action.Title == "" || (action.URL == "") == (action.Text == "") {
+			return "Submit a title and either a url or a text"
+		}
+	default:
+		return "Unknown kind of action"
+	}
+	return ""
+}
+
+// Queues the action of the user in the outbox and responds 202 with it,
+// code is the error code of the failed attempt if there was one
+func queueAction(c *gin.Context, action services.OutboxAction, code string) {
+	action.Username = currentSession(c).Username
+	action.Error = code
+	action, err := services.QueueAction(action)
+	if err != nil {
+		log.Println("Outbox:", err)
+		failMessage(c, "internal_error", "Could not queue the action", nil)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"queued": action})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Number of items in a page when neither :limit: nor :to: is given
+const defaultLimit = 30
+
+// A position in a list handed to the client as an opaque token so that the
+// next page is read from the same snapshot as the first one.
+type cursor struct {
+	List   string `json:"l"`           // Name of the list, or the comments of a News
+	At     int64  `json:"t,omitempty"` // Unix nanoseconds of the snapshot, 0 if not snapshotted
+	Past   bool   `json:"p,omitempty"` // The snapshot was asked for with 'at'
+	Offset int    `json:"o"`           // Number of items before the page
+}
+
+func (cur cursor) String() string {
+	v, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(v)
+}
+
+// Returns the cursor encoded in token if it points into the list
+func parseCursor(token string, list string) (cursor, bool) {
+	var cur cursor
+	v, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(v, &cur) != nil {
+		return cur, false
+	}
+	return cur, cur.List == list && cur.Offset >= 0 && cur.At >= 0
+}
+
+// Returns the position and size of the page asked for by the query. A
+// :cursor: takes precedence over :from: and :to:, and pages are never longer
+// than MaxLimit.
+func (api *API) readPage(c *gin.Context, list string, query RangeQuery) (cursor, int, bool) {
+	limit := query.Limit
+	cur := cursor{List: list}
+	if query.Cursor != "" {
+		var ok bool
+		if cur, ok = parseCursor(query.Cursor, list); !ok {
+			fail(c, "invalid_cursor", nil)
+			return cur, 0, false
+		}
+	} else {
+		if query.From > 0 {
+			cur.Offset = query.From - 1
+		}
+		if query.To > 0 && limit == 0 {
+			limit = query.To - cur.Offset
+		}
+	}
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if limit > api.MaxLimit {
+		limit = api.MaxLimit
+	}
+	return cur, limit, true
+}
+
+// Returns the query reading up to but not including 'to' instead of up to
+// 'to', or true if that leaves nothing to read.
+func excludeTo(query RangeQuery) (RangeQuery, bool) {
+	if query.Cursor != "" || query.Limit != 0 || query.To == 0 {
+		return query, false
+	}
+	if query.To <= query.From || query.To == 1 {
+		return query, true
+	}
+	query.To--
+	return query, false
+}
+
+// Responds with a page of values read with the cursor and limit and the
+// cursor of the next page, if any. fetched is when the values were scraped or
+// computed.
+func respondPage(c *gin.Context, values interface{}, cur cursor, limit int, total int, fetched time.Time) {
+	var next interface{}
+	if end := cur.Offset + limit; end < total {
+		cur.Offset = end
+		next = cur.String()
+	}
+	var fetchedAt interface{}
+	if !fetched.IsZero() {
+		fetchedAt = fetched
+	}
+	c.JSON(http.StatusOK, gin.H{"values": values, "next": next, "total": total, "fetched_at": fetchedAt})
+}
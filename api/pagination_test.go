@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []cursor{
+		{List: "top", Offset: 30},
+		{List: "top", At: 1792416092742071632, Offset: 60},
+		{List: "top", At: 1792416092742071632, Past: true, Offset: 30},
+		{List: "comments/123", Offset: 0},
+	}
+	for _, cur := range tests {
+		got, ok := parseCursor(cur.String(), cur.List)
+		if !ok || got != cur {
+			t.Errorf("parseCursor(%v.String()) = %v, %v, want the same cursor", cur, got, ok)
+		}
+	}
+}
+
+func TestParseCursorRejects(t *testing.T) {
+	encode := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other list", cursor{List: "ask", Offset: 30}.String()},
+		{"negative offset", encode(`{"l":"top","o":-1}`)},
+		{"negative time", encode(`{"l":"top","t":-5,"o":0}`)},
+		{"not base64", "!!!"},
+		{"not json", encode("top:30")},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"l":"top","o":1}`))},
+	}
+	for _, test := range tests {
+		if cur, ok := parseCursor(test.token, "top"); ok {
+			t.Errorf("%s: parseCursor(%q) = %v, want it rejected", test.name, test.token, cur)
+		}
+	}
+}
+
+func TestExcludeTo(t *testing.T) {
+	tests := []struct {
+		query RangeQuery
+		want  RangeQuery
+		empty bool
+	}{
+		{RangeQuery{From: 1, To: 11}, RangeQuery{From: 1, To: 10}, false},
+		{RangeQuery{To: 5}, RangeQuery{To: 4}, false},
+		{RangeQuery{From: 3, To: 3}, RangeQuery{From: 3, To: 3}, true},
+		{RangeQuery{To: 1}, RangeQuery{To: 1}, true},
+		{RangeQuery{From: 2}, RangeQuery{From: 2}, false},
+		{RangeQuery{From: 1, To: 11, Limit: 5}, RangeQuery{From: 1, To: 11, Limit: 5}, false},
+		{RangeQuery{To: 11, Cursor: "abc"}, RangeQuery{To: 11, Cursor: "abc"}, false},
+	}
+	for _, test := range tests {
+		got, empty := excludeTo(test.query)
+		if got != test.want || empty != test.empty {
+			t.Errorf("excludeTo(%+v) = %+v, %v, want %+v, %v", test.query, got, empty, test.want, test.empty)
+		}
+	}
+}
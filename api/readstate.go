@@ -0,0 +1,62 @@
+package api
+
+import (
+	"hnews/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sets up the routes of what the logged in user has read
+func (api *API) readRoutes(auth *gin.RouterGroup) {
+	// Marks all the comments of a story as seen, e.g. when read elsewhere
+	auth.POST("/me/read/:id", func(c *gin.Context) {
+		id, ok := idParam(c)
+		if !ok {
+			return
+		}
+		var comments int32
+		if news, ok := services.LatestNews(id); ok {
+			comments = news.Comments
+		}
+		username := currentSession(c).Username
+		services.VisitStory(username, int32(id), comments, services.MaxCommentID(id))
+		c.JSON(http.StatusOK, gin.H{"values": services.ReadStates(username, []int32{int32(id)})[int32(id)]})
+	})
+}
+
+// Sets the number of comments written since the user last opened each News
+func countNewComments(username string, news []services.News) {
+	ids := make([]int32, len(news))
+	for i, aNews := range news {
+		ids[i] = aNews.ID
+	}
+	states := services.ReadStates(username, ids)
+	for i := range news {
+		state, ok := states[news[i].ID]
+		if ok && news[i].Comments > state.Comments {
+			news[i].NewComments = news[i].Comments - state.Comments
+		}
+	}
+}
+
+// Records that the user opened the comments of the News and flags the
+// Comments written since the previous visit as new
+func visitComments(username string, newsid int, comments []services.Comment) {
+	var count, maxID int32
+	for _, aComment := range comments {
+		if aComment.ID > maxID {
+			maxID = aComment.ID
+		}
+	}
+	if news, ok := services.LatestNews(newsid); ok {
+		count = news.Comments
+	}
+	seen, opened := services.VisitStory(username, int32(newsid), count, maxID)
+	if !opened {
+		return
+	}
+	for i := range comments {
+		comments[i].New = comments[i].ID > seen
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"hnews/services"
+	"testing"
+)
+
+func TestNewComments(t *testing.T) {
+	if err := services.Open(t.TempDir()); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer services.Close()
+	services.VisitStory("alice", 1, 10, 100)
+	services.VisitStory("alice", 2, 30, 200)
+
+	news := []services.News{{ID: 1, Comments: 15}, {ID: 2, Comments: 25}, {ID: 3, Comments: 7}}
+	countNewComments("alice", news)
+	// Story 2 lost comments and story 3 was never opened
+	for i, want := range []int32{5, 0, 0} {
+		if news[i].NewComments != want {
+			t.Errorf("NewComments of story %d = %d, want %d", news[i].ID, news[i].NewComments, want)
+		}
+	}
+
+	comments := []services.Comment{{ID: 90}, {ID: 110}}
+	visitComments("bob", 1, comments)
+	if comments[0].New || comments[1].New {
+		t.Errorf("comments on the first visit = %+v, want none new", comments)
+	}
+}
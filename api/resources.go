@@ -0,0 +1,43 @@
+package api
+
+import (
+	"hnews/scraper"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A list served by the API as described by GET /v1/resources
+type resourceInfo struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Path      string `json:"path"`       // Path of the endpoint serving the list
+	SourceURL string `json:"source_url"` // Page of Hacker News the list is scraped from
+	Parser    string `json:"parser"`
+	Pages     int    `json:"pages"`    // Pages scraped each cycle
+	Interval  int64  `json:"interval"` // Least seconds between two cycles, 0 if scraped continuously
+}
+
+func newResourceInfo(resource scraper.Resource) resourceInfo {
+	return resourceInfo{
+		Name:      resource.Name,
+		Type:      resource.Type.String(),
+		Path:      "/v1" + resource.URL,
+		SourceURL: string(resource.SourceURL),
+		Parser:    string(resource.Parser),
+		Pages:     resource.Schedule.Pages,
+		Interval:  int64(resource.Schedule.Interval.Seconds()),
+	}
+}
+
+// Sets up the routes describing the lists the server offers
+func (api *API) resourceRoutes(r *gin.Engine) {
+	// GET the lists that are scraped and served
+	r.GET("/v1/resources", func(c *gin.Context) {
+		infos := make([]resourceInfo, 0, len(api.Resources))
+		for _, resource := range api.Resources {
+			infos = append(infos, newResourceInfo(resource))
+		}
+		c.JSON(http.StatusOK, gin.H{"values": infos})
+	})
+}
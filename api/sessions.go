@@ -0,0 +1,84 @@
+package api
+
+import (
+	"hnews/hn"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginRequest is the body of /v1/login
+type LoginRequest struct {
+	Username string `form:"username" json:"username" binding:"required"`
+	Password string `form:"password" json:"password" binding:"required"`
+}
+
+// Sets up the routes logging users in and out and managing their sessions
+func (api *API) sessionRoutes(r *gin.Engine, auth *gin.RouterGroup) {
+	r.POST("/v1/login", func(c *gin.Context) {
+		if !api.rejectQueryPayload(c) {
+			return
+		}
+		var req LoginRequest
+		if err := api.bindBody(c, &req); err != nil {
+			failValidation(c, err)
+			return
+		}
+
+		session, err := hn.Login(c.Request.Context(), req.Username, req.Password)
+		if err != nil {
+			actionError(c, err)
+			return
+		}
+
+		apikey, _, err := api.Sessions.Create(session.Username, session.Cookie())
+		if err != nil {
+			log.Println("Login:", err)
+			failMessage(c, "internal_error", "Could not create API key", nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"apikey": apikey})
+	})
+
+	auth.POST("/logout", func(c *gin.Context) {
+		api.Sessions.Delete(c.MustGet("apikey").(string))
+		c.Status(http.StatusOK)
+	})
+
+	/** Sessions of the logged in user **/
+	auth.GET("/me/sessions", func(c *gin.Context) {
+		s := currentSession(c)
+		c.JSON(http.StatusOK, gin.H{"values": api.Sessions.List(s.Username), "current": s.ID})
+	})
+
+	auth.DELETE("/me/sessions/:id", func(c *gin.Context) {
+		s := currentSession(c)
+		if err := api.Sessions.Revoke(s.Username, c.Param("id")); err != nil {
+			fail(c, "session_not_found", nil)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	// Gives the session a new API key, the old one stops working
+	auth.POST("/me/sessions/rotate", func(c *gin.Context) {
+		apikey, err := api.Sessions.Rotate(c.MustGet("apikey").(string))
+		if err != nil {
+			fail(c, "not_logged_in", nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"apikey": apikey})
+	})
+}
+
+// Resumes the Session set by authenticate on Hacker News
+func hnSession(c *gin.Context) (*hn.Session, bool) {
+	s := currentSession(c)
+	session, err := hn.Resume(s.Username, s.Cookie)
+	if err != nil {
+		actionError(c, err)
+		return nil, false
+	}
+	return session, true
+}
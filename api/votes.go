@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"hnews/hn"
+	"hnews/scraper"
+	"hnews/services"
+	"hnews/session"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pages are scraped again for the vote state of a user once older than this
+const voteStateTTL = 5 * time.Minute
+
+// At most this many pages are scraped for the vote state of one request
+const maxVotePages = 4
+
+// Requests wait at most this long for the vote state, then the pages are
+// scraped in the background and the state cached so far is used
+const voteStateWait = 2 * time.Second
+
+// The votes of users who have not made a request for this long are dropped
+const voteCacheIdle = time.Hour
+
+// At most this many users are cached, the least recently seen are dropped first
+const maxVoteUsers = 10000
+
+// News per page of the lists on Hacker News
+const newsPerPage = 30
+
+// voteCache keeps what each user has voted on, in memory, as scraped from the
+// pages of Hacker News as they see them.
+type voteCache struct {
+	mutex sync.Mutex
+	users map[string]*userVotes
+	swept time.Time       // When the idle users were last dropped
+	ctx   context.Context // Done once the API stops, ends the scrapes in the background
+}
+
+type userVotes struct {
+	voted       map[int32]bool
+	downvotable map[int32]bool
+	fetched     map[string]time.Time // When each page was last scraped
+	fetching    map[string]bool      // Pages being scraped right now
+	seen        time.Time            // Last request of the user
+}
+
+func newVoteCache(ctx context.Context) *voteCache {
+	cache := new(voteCache)
+	cache.users = make(map[string]*userVotes)
+	cache.swept = time.Now()
+	cache.ctx = ctx
+	return cache
+}
+
+// Returns the votes of the user, the mutex must be held
+func (cache *voteCache) user(username string) *userVotes {
+	now := time.Now()
+	if now.Sub(cache.swept) > voteStateTTL {
+		cache.sweep(now)
+	}
+	votes, ok := cache.users[username]
+	if !ok {
+		if len(cache.users) >= maxVoteUsers {
+			cache.evictOldest()
+		}
+		votes = &userVotes{make(map[int32]bool), make(map[int32]bool), make(map[string]time.Time), make(map[string]bool), now}
+		cache.users[username] = votes
+	}
+	votes.seen = now
+	return votes
+}
+
+// Drops the idle users and the stale pages of the others, the mutex must be held
+func (cache *voteCache) sweep(now time.Time) {
+	cache.swept = now
+	for username, votes := range cache.users {
+		if now.Sub(votes.seen) > voteCacheIdle {
+			delete(cache.users, username)
+			continue
+		}
+		for path, fetched := range votes.fetched {
+			if now.Sub(fetched) > voteStateTTL {
+				delete(votes.fetched, path)
+			}
+		}
+	}
+}
+
+// Drops the least recently seen user, the mutex must be held
+func (cache *voteCache) evictOldest() {
+	var oldest string
+	var seen time.Time
+	for username, votes := range cache.users {
+		if oldest == "" || votes.seen.Before(seen) {
+			oldest, seen = username, votes.seen
+		}
+	}
+	delete(cache.users, oldest)
+}
+
+// Scrapes the pages of the user that are not cached or stale in the
+// background, waiting at most voteStateWait or until ctx is done for them.
+// The scrapes outlive ctx so that the next request finds them cached.
+func (cache *voteCache) refresh(ctx context.Context, s *session.Session, paths []string) {
+	var stale []string
+	cache.mutex.Lock()
+	votes := cache.user(s.Username)
+	for _, path := range paths {
+		if time.Since(votes.fetched[path]) > voteStateTTL && !votes.fetching[path] {
+			votes.fetching[path] = true
+			stale = append(stale, path)
+		}
+	}
+	cache.mutex.Unlock()
+	if len(stale) == 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.fetch(s, votes, stale)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	case <-time.After(voteStateWait):
+	}
+}
+
+// Scrapes the vote state of the user on the pages into votes
+func (cache *voteCache) fetch(s *session.Session, votes *userVotes, paths []string) {
+	defer func() {
+		cache.mutex.Lock()
+		for _, path := range paths {
+			delete(votes.fetching, path)
+		}
+		cache.mutex.Unlock()
+	}()
+
+	hnSession, err := hn.Resume(s.Username, s.Cookie)
+	if err != nil {
+		log.Println("Votes:", err)
+		return
+	}
+	for _, path := range paths {
+		state, err := hnSession.VoteState(cache.ctx, path)
+		if err != nil {
+			log.Println("Votes:", err)
+			return // The rest are scraped on the next request
+		}
+		cache.mutex.Lock()
+		for _, id := range state.Items {
+			delete(votes.voted, int32(id))
+			delete(votes.downvotable, int32(id))
+		}
+		for _, id := range state.Voted {
+			votes.voted[int32(id)] = true
+		}
+		for _, id := range state.Downvotable {
+			votes.downvotable[int32(id)] = true
+		}
+		votes.fetched[path] = time.Now()
+		cache.mutex.Unlock()
+	}
+}
+
+// Records a vote made through the API without waiting for the next scrape
+func (cache *voteCache) set(username string, id int, voted bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	votes := cache.user(username)
+	if voted {
+		votes.voted[int32(id)] = true
+	} else {
+		delete(votes.voted, int32(id))
+	}
+}
+
+func (cache *voteCache) annotateNews(username string, news []services.News) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	votes := cache.user(username)
+	for i := range news {
+		news[i].Voted = votes.voted[news[i].ID]
+		news[i].CanDownvote = votes.downvotable[news[i].ID]
+		news[i].IsOwn = news[i].Author == username
+	}
+}
+
+func (cache *voteCache) annotateComments(username string, comments []services.Comment) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	votes := cache.user(username)
+	for i := range comments {
+		comments[i].Voted = votes.voted[comments[i].ID]
+		comments[i].CanDownvote = votes.downvotable[comments[i].ID]
+		comments[i].IsOwn = comments[i].Author == username
+	}
+}
+
+// Middleware looking up the Session of the API key in the Authorization
+// header like authenticate, but carrying on anonymously without one.
+func (api *API) identify(c *gin.Context) {
+	apikey := strings.TrimSpace(strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "))
+	if apikey == "" {
+		return
+	}
+	if s, err := api.Sessions.Get(apikey); err == nil {
+		c.Set("session", s)
+	}
+}
+
+// Returns the Session set by identify, if any
+func optionalSession(c *gin.Context) (*session.Session, bool) {
+	s, ok := c.Get("session")
+	if !ok {
+		return nil, false
+	}
+	return s.(*session.Session), true
+}
+
+// Sets the vote and read state of the logged in user on the News ranked from
+// index from to index to on the list
+func (api *API) annotateNews(c *gin.Context, resource scraper.Resource, from int, to int, news []services.News) {
+	s, ok := optionalSession(c)
+	if !ok {
+		return
+	}
+	countNewComments(s.Username, news)
+	var paths []string
+	for page := (from-1)/newsPerPage + 1; page <= (to-1)/newsPerPage+1 && len(paths) < maxVotePages; page++ {
+		paths = append(paths, strings.TrimPrefix(string(resource.SourceURL), scraper.BaseURL)+strconv.Itoa(page))
+	}
+	api.votes.refresh(c.Request.Context(), s, paths)
+	api.votes.annotateNews(s.Username, news)
+}
+
+// Sets the vote and read state of the logged in user on the Comments of the
+// News, which counts as the user having opened the News
+func (api *API) annotateComments(c *gin.Context, newsid int, comments []services.Comment) {
+	s, ok := optionalSession(c)
+	if !ok {
+		return
+	}
+	visitComments(s.Username, newsid, comments)
+	api.votes.refresh(c.Request.Context(), s, []string{"item?id=" + strconv.Itoa(newsid)})
+	api.votes.annotateComments(s.Username, comments)
+}
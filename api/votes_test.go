@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVoteCacheDropsIdleUsers(t *testing.T) {
+	cache := newVoteCache(context.Background())
+	cache.user("alice").fetched["news?p=1"] = time.Now().Add(-2 * voteStateTTL)
+	cache.user("bob").seen = time.Now().Add(-2 * voteCacheIdle)
+
+	cache.swept = time.Now().Add(-2 * voteStateTTL)
+	cache.user("carol")
+	if _, ok := cache.users["bob"]; ok {
+		t.Error("the idle user is still cached")
+	}
+	alice, ok := cache.users["alice"]
+	if !ok {
+		t.Fatal("the active user was dropped")
+	}
+	if len(alice.fetched) != 0 {
+		t.Errorf("fetched = %v, want the stale page dropped", alice.fetched)
+	}
+}
+
+func TestVoteCacheIsCapped(t *testing.T) {
+	cache := newVoteCache(context.Background())
+	for i := 0; i < maxVoteUsers; i++ {
+		cache.user("user" + strconv.Itoa(i))
+	}
+	cache.users["user0"].seen = time.Now().Add(-time.Minute)
+	cache.user("newcomer")
+	if len(cache.users) != maxVoteUsers {
+		t.Errorf("%d users cached, want %d", len(cache.users), maxVoteUsers)
+	}
+	if _, ok := cache.users["user0"]; ok {
+		t.Error("the least recently seen user is still cached")
+	}
+}
+
+func TestVoteCacheSet(t *testing.T) {
+	cache := newVoteCache(context.Background())
+	cache.set("alice", 7, true)
+	if !cache.user("alice").voted[7] {
+		t.Error("the vote is not recorded")
+	}
+	cache.set("alice", 7, false)
+	if cache.user("alice").voted[7] {
+		t.Error("the unvote is not recorded")
+	}
+}
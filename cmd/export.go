@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hnews/config"
+	"hnews/scraper"
+	"hnews/services"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Layouts accepted by export -at
+var exportLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+// A News as written by export, with its thread and history if asked for
+type exportedNews struct {
+	services.News
+	Thread  []services.Comment `json:"thread,omitempty"`
+	History []services.Sample  `json:"history,omitempty"`
+}
+
+// Writes the News of a list as JSON lines, one News per line, read-only so
+// that the data can be exported while the server is not running
+func runExport(fs *flag.FlagSet, args []string) error {
+	name := fs.String("resource", "top", "Name of the list to export, see GET /v1/resources.")
+	at := fs.String("at", "", "Export the snapshot of the list taken at or before this time instead of the last scrape, e.g. 2006-01-02T15:04.")
+	thread := fs.Bool("comments", false, "Include the comments of each news.")
+	history := fs.Bool("history", false, "Include the samples of the points, comments and ranks of each news.")
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+	if _, err := scraper.LookupResource(scraper.Resources, *name); err != nil {
+		return fmt.Errorf("%v %q", err, *name)
+	}
+
+	if err := services.OpenScrapedReadOnly(cfg.DataDir); err != nil {
+		return fmt.Errorf("%v, is the server running?", err)
+	}
+	defer services.Close()
+	store := services.NewReplicaService(*name)
+	b, err := services.OpenBolt(filepath.Join(cfg.DataDir, store.DB().File), true)
+	if err != nil {
+		return fmt.Errorf("%v, is the server running?", err)
+	}
+	store.DB().Replace(b)
+	defer store.Close()
+
+	var news []services.News
+	if *at != "" {
+		t, err := parseExportTime(*at)
+		if err != nil {
+			return err
+		}
+		var taken time.Time
+		if taken, news = services.ReadSnapshot(*name, t); taken.IsZero() {
+			return fmt.Errorf("no snapshot of %s taken at or before %s", *name, *at)
+		}
+	} else {
+		news = store.ReadNews(1, store.CountNews())
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, aNews := range news {
+		exported := exportedNews{News: aNews}
+		if *thread {
+			exported.Thread = services.ReadComments(int(aNews.ID), 1, services.CountComments(int(aNews.ID))+1)
+		}
+		if *history {
+			exported.History = services.ReadHistory(int(aNews.ID), time.Unix(0, 0))
+		}
+		if err := encoder.Encode(exported); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Parses the time given to export -at in one of the exportLayouts
+func parseExportTime(value string) (time.Time, error) {
+	for _, layout := range exportLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use e.g. 2006-01-02T15:04", value)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hnews/config"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/boltdb/bolt"
+)
+
+// Longest value printed in full by inspect
+const maxInspectValue = 160
+
+// Prints the buckets of the databases in the data directory with the number
+// of keys in them and the first records of each
+func runInspect(fs *flag.FlagSet, args []string) error {
+	only := fs.String("db", "", "Only inspect the database in this file of the data directory, e.g. top-news.")
+	bucket := fs.String("bucket", "", "Only inspect the bucket with this name.")
+	samples := fs.Int("samples", 3, "Number of the records printed of each bucket.")
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+
+	files, err := databaseFiles(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	if *only != "" {
+		files = []string{*only}
+	}
+	for _, file := range files {
+		if err := inspectDB(filepath.Join(cfg.DataDir, file), *bucket, *samples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the names of the Bolt files in dir
+func databaseFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if strings.HasSuffix(name, "-global") || strings.HasSuffix(name, "-news") || name == "sessions" {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Prints the buckets of one database, read-only so that it can be inspected
+// while the server is not running
+func inspectDB(path string, only string, samples int) error {
+	db, err := bolt.Open(path, 0644, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("could not open %s, is the server running? %v", path, err)
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		var buckets int
+		tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			buckets++
+			return nil
+		})
+		fmt.Printf("%s: %d buckets, %d bytes\n", path, buckets, tx.Size())
+
+		// The lists and history have hundreds of buckets, only the first ones are sampled
+		printed := 0
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if only != "" && string(name) != only {
+				return nil
+			}
+			if only == "" && printed >= samples {
+				return nil
+			}
+			printed++
+			inspectBucket(b, string(name), 1, samples)
+			return nil
+		})
+	})
+}
+
+// Prints the number of keys in the bucket and its first records, recursing
+// into the nested buckets
+func inspectBucket(b *bolt.Bucket, name string, depth int, samples int) {
+	indent := strings.Repeat("  ", depth)
+	stats := b.Stats()
+	fmt.Printf("%s%s: %d keys, %d nested buckets\n", indent, printable(name), stats.KeyN, stats.BucketN-1)
+
+	c := b.Cursor()
+	i := 0
+	for k, v := c.First(); k != nil && i < samples; k, v = c.Next() {
+		i++
+		if v == nil {
+			inspectBucket(b.Bucket(k), string(k), depth+1, samples)
+			continue
+		}
+		fmt.Printf("%s  %s = %s\n", indent, printable(string(k)), printable(string(v)))
+	}
+}
+
+// Returns text as is if it is printable, otherwise as hex, cut to a line
+func printable(text string) string {
+	if !utf8.ValidString(text) || strings.IndexFunc(text, func(r rune) bool { return r < ' ' && r != '\n' && r != '\t' }) >= 0 {
+		text = "0x" + hex.EncodeToString([]byte(text))
+	}
+	text = strings.Replace(text, "\n", `\n`, -1)
+	if len(text) > maxInspectValue {
+		text = text[:maxInspectValue] + "..."
+	}
+	return text
+}
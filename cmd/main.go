@@ -3,79 +3,158 @@ package main
 import (
 	"flag"
 	"fmt"
-	"hnews/api"
-	"hnews/scraper"
+	"hnews/config"
 	"hnews/services"
+	"log"
 	"math/rand"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 )
 
+// A subcommand of hnews
+type command struct {
+	name  string
+	usage string
+	run   func(fs *flag.FlagSet, args []string) error
+}
+
+// The subcommands, hnews without one runs all
+var commands = []command{
+	{"all", "Scrape Hacker News and serve the API, the default", runAll},
+	{"serve", "Serve the API over the data scraped so far", runServe},
+	{"scrape", "Scrape Hacker News without serving the API", runScrape},
+	{"scrape-once", "Scrape one cycle of a list, print a summary and exit", runScrapeOnce},
+	{"inspect", "Print the buckets, counts and sample records of the databases", runInspect},
+	{"export", "Write the news of a list as JSON lines", runExport},
+	{"config", "Print the settings as they would be loaded", runConfig},
+}
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
-	debug := flag.Bool("debug", true, "Debug mode, defaults to true.")
-	flag.Parse()
-	if *debug {
-		fmt.Println("Running in DEBUG MODE ... Pass flag -debug=false to disable.")
+	name, args := "all", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		fs := flag.NewFlagSet("hnews "+cmd.name, flag.ContinueOnError)
+		if err := cmd.run(fs, args); err == flag.ErrHelp {
+			os.Exit(2)
+		} else if err != nil {
+			log.Fatalln(err)
+		}
+		return
 	}
 
-	topResource := scraper.Resource{scraper.TopNewsType,
-		scraper.TopBaseURL,
-		"/top",
-		"top", nil}
-	askResource := scraper.Resource{scraper.AskNewsType,
-		scraper.AskBaseURL,
-		"/ask",
-		"ask", nil}
-	showResource := scraper.Resource{scraper.ShowNewsType,
-		scraper.ShowBaseURL,
-		"/show",
-		"show", nil}
-	newestResource := scraper.Resource{scraper.NewestNewsType,
-		scraper.NewestBaseURL,
-		"/newest",
-		"newest", nil}
-
-	// Setup all the scrapers and their ResourceTypes & ResourceURLs
-	topScraper := scraper.NewScraper(topResource)
-	topResource.BackingStore = topScraper.DatabaseService
-	go topScraper.StartScraper(*debug)
-
-	askScraper := scraper.NewScraper(askResource)
-	askResource.BackingStore = askScraper.DatabaseService
-	go askScraper.StartScraper(*debug)
+	if name != "help" {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	}
+	fmt.Fprintln(os.Stderr, "Usage: hnews [command] [flags], see hnews <command> -h for the flags")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.usage)
+	}
+	os.Exit(2)
+}
 
-	showScraper := scraper.NewScraper(showResource)
-	showResource.BackingStore = showScraper.DatabaseService
-	go showScraper.StartScraper(*debug)
+// Scrapes and serves the API like before there were commands
+func runAll(fs *flag.FlagSet, args []string) error {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+	srv, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+	if err := services.Open(cfg.DataDir); err != nil {
+		return err
+	}
+	srv.startScrapers(true)
+	srv.startWorkers()
+	srv.startAPI()
+	return srv.waitForShutdown()
+}
 
-	newestScraper := scraper.NewScraper(newestResource)
-	newestResource.BackingStore = newestScraper.DatabaseService
-	go newestScraper.StartScraper(*debug)
+// Serves the API over the data published by a scrape process in the snapshot
+// directory, or the data stored in the data directory if there is none. The
+// databases of the users are always stored in the data directory.
+func runServe(fs *flag.FlagSet, args []string) error {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+	srv, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.SnapshotDir != "" {
+		if err := services.OpenUsers(cfg.DataDir); err != nil {
+			return err
+		}
+		if err := srv.followSnapshots(); err != nil {
+			services.Close()
+			return err
+		}
+	} else {
+		// Without scrape cycles the news are ranked every minute
+		if err := services.Open(cfg.DataDir); err != nil {
+			return err
+		}
+		srv.openStores()
+		srv.spawn(func() { srv.recomputeEvery(time.Minute) })
+	}
+	srv.startWorkers()
+	srv.startAPI()
+	return srv.waitForShutdown()
+}
 
-	// Setup the API by giving it the databases in which the scrapers dumps their data
-	api := new(api.API)
-	api.TopEndpoint = topResource
-	api.AskEndpoint = askResource
-	api.ShowEndpoint = showResource
-	api.NewestEndpoint = newestResource
-	go api.StartAPI(*debug)
+// Scrapes and enriches the lists without the API or the workers acting for
+// the logged in users, publishing the data to the snapshot directory if set
+func runScrape(fs *flag.FlagSet, args []string) error {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+	srv, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+	if err := services.OpenScraped(cfg.DataDir); err != nil {
+		return err
+	}
+	srv.startScrapers(false)
+	return srv.waitForShutdown()
+}
 
-	// When closed make sure to call Close on all the underlying bolt.DB instances.
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGTERM, os.Interrupt)
-	go func() {
-		<-ch
-		topScraper.DatabaseService.Close()
-		askScraper.DatabaseService.Close()
-		showScraper.DatabaseService.Close()
-		newestScraper.DatabaseService.Close()
-		services.Commentsdb.Close()
-		os.Exit(1)
-	}()
+// Scrapes one cycle of a list and prints what was found
+func runScrapeOnce(fs *flag.FlagSet, args []string) error {
+	name := fs.String("resource", "top", "Name of the list to scrape, see GET /v1/resources.")
+	dryRun := fs.Bool("dry-run", false, "Only print the summary, do not save the news.")
+	top := fs.Int("show", 10, "Number of the news to print.")
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+	srv, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+	if err := services.OpenScraped(cfg.DataDir); err != nil {
+		return err
+	}
+	defer srv.close()
+	return srv.scrapeOnce(*name, !*dryRun, *top)
+}
 
-	select {} // Block forever and ever
+// Prints the settings
+func runConfig(fs *flag.FlagSet, args []string) error {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+	return cfg.Print(os.Stdout)
 }
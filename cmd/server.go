@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hnews/api"
+	"hnews/config"
+	"hnews/enrich"
+	"hnews/hn"
+	"hnews/notify"
+	"hnews/outbox"
+	"hnews/ranking"
+	"hnews/replica"
+	"hnews/scraper"
+	"hnews/services"
+	"hnews/session"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The parts of the server the commands start
+type server struct {
+	cfg         *config.Config
+	resources   []scraper.Resource
+	stores      []*services.DatabaseService // The databases of the lists
+	engine      *ranking.Engine
+	client      *enrich.Client
+	thumbnailer *enrich.Thumbnailer
+	sessions    *session.Store
+	publisher   *replica.Publisher // Publishes the data a last time on shutdown, if scraping
+	outbox      *outbox.Worker     // Delivers the actions queued by the API
+	following   bool               // The lists are snapshots published by a scrape process
+
+	ctx     context.Context    // Done once the server shuts down
+	stop    context.CancelFunc // Stops the scheduling of new work
+	tasks   sync.WaitGroup     // The goroutines drained before the databases are closed
+	apiDone chan struct{}      // Closed once the API stopped serving, nil without an API
+	failed  chan error         // A task that could not go on, shuts the server down
+}
+
+// Sets up the resources by the Config, the commands open the databases they need
+func newServer(cfg *config.Config) (*server, error) {
+	if cfg.Debug {
+		fmt.Println("Running in DEBUG MODE ... Pass flag -debug=false to disable.")
+	}
+	hn.Timeout = cfg.HNTimeout
+	hn.RetryTimeout = cfg.HNRetryTimeout
+	scraper.RetryTimeout = cfg.ScrapeRetryTimeout
+
+	srv := new(server)
+	srv.cfg = cfg
+	srv.ctx, srv.stop = context.WithCancel(context.Background())
+	srv.failed = make(chan error, 1)
+
+	// Every list in the registry gets a scraper and an endpoint
+	srv.resources = append([]scraper.Resource(nil), scraper.Resources...)
+	for i := range srv.resources {
+		srv.resources[i].Schedule = cfg.Schedule(srv.resources[i].Name, srv.resources[i].Schedule)
+	}
+	if err := scraper.ValidateResources(srv.resources); err != nil {
+		return nil, err
+	}
+
+	srv.engine = ranking.NewEngine(cfg.Ranking)
+	srv.client = enrich.NewClient(cfg.EnrichInterval)
+	srv.thumbnailer = enrich.NewThumbnailer(cfg.Path(cfg.ThumbnailDir), srv.client)
+	return srv, nil
+}
+
+// Starts a scraper for every list along with the enrichment of the news, the
+// tracking of the news that left the lists, the pruning of their history and
+// the backfill of the archive. The bookmarks are only refreshed if their
+// database is open in this process.
+func (srv *server) startScrapers(refreshBookmarks bool) {
+	cfg := srv.cfg
+
+	// Rescore the trending and rising news after every scrape cycle
+	recompute := func(name string, news []services.News) {
+		srv.engine.Recompute()
+	}
+
+	// Fetch the metadata of the links of the news in the background
+	enricher := enrich.NewEnricher(srv.client)
+	srv.spawn(func() { enricher.Start(srv.ctx, cfg.Debug) })
+	enqueue := func(name string, news []services.News) {
+		enricher.Enqueue(news)
+	}
+
+	// Extract the linked articles of the top news for offline reading
+	reader := enrich.NewReader(srv.client)
+	srv.spawn(func() { reader.Start(srv.ctx, cfg.Debug) })
+	read := func(name string, news []services.News) {
+		reader.Enqueue(news)
+	}
+
+	// Generate thumbnails of the preview images of the news
+	srv.spawn(func() { srv.thumbnailer.Start(srv.ctx, cfg.Debug) })
+	thumbnail := func(name string, news []services.News) {
+		srv.thumbnailer.Enqueue(news)
+	}
+
+	// Keep the copies of the bookmarked news up to date while they are on the lists
+	bookmark := func(name string, news []services.News) {
+		services.RefreshBookmarks(news)
+	}
+
+	// Setup all the scrapers and their ResourceTypes & ResourceURLs
+	for i := range srv.resources {
+		aScraper := scraper.NewScraper(srv.resources[i])
+		srv.resources[i].BackingStore = aScraper.DatabaseService
+		srv.stores = append(srv.stores, aScraper.DatabaseService)
+		aScraper.OnCycle(recompute)
+		aScraper.OnCycle(enqueue)
+		aScraper.OnCycle(thumbnail)
+		if refreshBookmarks {
+			aScraper.OnCycle(bookmark)
+		}
+		if srv.resources[i].ReadArticles {
+			aScraper.OnCycle(read)
+		}
+		srv.spawn(func() { aScraper.StartScraper(srv.ctx, cfg.Debug) })
+	}
+
+	// Keep sampling the news that left the lists
+	srv.spawn(func() { scraper.StartTracker(srv.ctx, cfg.Track, scraper.StaleAfter(srv.resources), cfg.Debug) })
+
+	// Drop the samples and snapshots older than the configured history
+	srv.spawn(func() { srv.pruneEvery(time.Hour) })
+
+	// Archive the front pages of the days before we started scraping
+	if cfg.Backfill > 0 {
+		srv.spawn(func() { scraper.Backfill(srv.ctx, cfg.Backfill, cfg.Debug) })
+	}
+
+	// Publish the data for the API processes
+	if cfg.SnapshotDir != "" {
+		srv.publisher = replica.NewPublisher(cfg.SnapshotDir, srv.stores)
+		srv.publisher.Interval = cfg.SnapshotInterval
+		srv.publisher.ThumbnailDir = srv.thumbnailer.Dir
+		srv.spawn(func() { srv.publisher.Start(srv.ctx, cfg.Debug) })
+	}
+}
+
+// Opens the databases of the lists without scraping them
+func (srv *server) openStores() {
+	for i := range srv.resources {
+		store := services.NewService(srv.resources[i].Name)
+		srv.resources[i].BackingStore = store
+		srv.stores = append(srv.stores, store)
+	}
+}
+
+// Serves the lists from the data published by a separate scrape process,
+// switching to each new snapshot as it is published
+func (srv *server) followSnapshots() error {
+	for i := range srv.resources {
+		store := services.NewReplicaService(srv.resources[i].Name)
+		srv.resources[i].BackingStore = store
+		srv.stores = append(srv.stores, store)
+	}
+
+	// Without scrape cycles the news are ranked and the bookmarks refreshed on every new snapshot
+	srv.following = true
+	srv.thumbnailer.Dir = replica.Thumbnails(srv.cfg.SnapshotDir)
+	follower := replica.NewFollower(srv.cfg.SnapshotDir, srv.stores)
+	follower.OnLoad = func() {
+		srv.engine.Recompute()
+		for _, store := range srv.stores {
+			services.RefreshBookmarks(store.ReadNews(1, store.CountNews()))
+		}
+	}
+	if _, err := follower.Load(); err != nil {
+		return fmt.Errorf("could not load the snapshot in %s, is scrape running with the same -snapshot-dir? %v", srv.cfg.SnapshotDir, err)
+	}
+	srv.spawn(func() { follower.Start(srv.ctx, srv.cfg.Debug) })
+	return nil
+}
+
+// Ranks the trending and rising news at the interval until the server shuts down
+func (srv *server) recomputeEvery(interval time.Duration) {
+	for {
+		srv.engine.Recompute()
+		select {
+		case <-srv.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Deletes what is older than kept at the interval until the server shuts down
+func (srv *server) pruneEvery(interval time.Duration) {
+	for {
+		// The snapshots are restored from the samples, so they go first
+		before := time.Now().Add(-srv.cfg.History)
+		services.PruneSnapshots(before)
+		services.PruneHistory(before)
+		select {
+		case <-srv.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Sessions are encrypted with the key derived from the secret or a generated key file
+func (srv *server) openSessions() {
+	if srv.sessions != nil {
+		return
+	}
+	cfg := srv.cfg
+	key, err := session.LoadKey(cfg.SessionSecret, cfg.Path(cfg.SessionKeyFile))
+	if err != nil {
+		log.Fatalln("Could not load session key:", err)
+	}
+	sessions, err := session.NewStore(cfg.Path("sessions"), key)
+	if err != nil {
+		log.Fatalln("Could not open sessions:", err)
+	}
+	sessions.IdleTimeout = cfg.SessionIdle
+	sessions.MaxAge = cfg.SessionMaxAge
+	srv.spawn(func() { sessions.StartPurging(srv.ctx, time.Hour) })
+	srv.sessions = sessions
+}
+
+// Starts the workers acting on behalf of the logged in users
+func (srv *server) startWorkers() {
+	srv.openSessions()
+
+	// Check the threads of the logged in users for replies
+	if srv.cfg.NotifyInterval > 0 {
+		notifier := notify.NewNotifier(srv.sessions)
+		notifier.Interval = srv.cfg.NotifyInterval
+		srv.spawn(func() { notifier.Start(srv.ctx, srv.cfg.Debug) })
+	}
+
+	// Deliver the actions queued while Hacker News was throttling or unavailable
+	srv.outbox = outbox.NewWorker(srv.sessions)
+	srv.outbox.Code = api.ErrorCode
+	srv.spawn(func() { srv.outbox.Start(srv.ctx, srv.cfg.Debug) })
+}
+
+// Serves the API until the server shuts down, failing the server if it cannot listen
+func (srv *server) startAPI() {
+	srv.openSessions()
+
+	// Setup the API by giving it the databases in which the scrapers dumps their data
+	api := new(api.API)
+	api.Resources = srv.resources
+	api.Ranking = srv.engine
+	api.Thumbnails = srv.thumbnailer
+	api.Sessions = srv.sessions
+	api.Outbox = srv.outbox
+	api.LegacyQueryAuth = srv.cfg.LegacyQueryAuth
+	api.MaxLimit = srv.cfg.MaxLimit
+	api.Port = srv.cfg.Port
+	api.ShutdownTimeout = srv.cfg.ShutdownTimeout
+	api.ReadOnly = srv.following
+	srv.apiDone = make(chan struct{})
+	srv.spawn(func() {
+		defer close(srv.apiDone)
+		if err := api.StartAPI(srv.ctx, srv.cfg.Debug); err != nil {
+			srv.fail(fmt.Errorf("API: %v", err))
+		}
+	})
+}
+
+// Scrapes one cycle of the list with the given name and prints the first
+// show News of it
+func (srv *server) scrapeOnce(name string, save bool, show int) error {
+	resource, err := scraper.LookupResource(srv.resources, name)
+	if err != nil {
+		return fmt.Errorf("%v %q", err, name)
+	}
+	aScraper := scraper.NewScraper(resource)
+	srv.stores = append(srv.stores, aScraper.DatabaseService)
+
+	summary := aScraper.ScrapeOnce(srv.ctx, save)
+	fmt.Printf("Scraped %d news from %d of %d pages of %s in %v\n",
+		len(summary.News), summary.Pages-len(summary.Failed), summary.Pages, summary.Name, summary.Took)
+	for page, err := range summary.Failed {
+		fmt.Printf("  page %d failed: %v\n", page, err)
+	}
+	for i, aNews := range summary.News {
+		if i == show {
+			fmt.Printf("  ... and %d more\n", len(summary.News)-show)
+			break
+		}
+		fmt.Printf("  %3d. %s (%d points, %d comments, id %d)\n", aNews.Rank, aNews.Title, aNews.Points, aNews.Comments, aNews.ID)
+	}
+	if !save {
+		fmt.Println("Dry run, nothing was saved")
+	}
+	if len(summary.News) == 0 {
+		return fmt.Errorf("no news found on %s", resource.SourceURL)
+	}
+	return nil
+}
+
+// Closes all the databases
+func (srv *server) close() {
+	for _, store := range srv.stores {
+		store.Close()
+	}
+	services.Close()
+	if srv.sessions != nil {
+		srv.sessions.Close()
+	}
+}
+
+// Runs task as a goroutine that is drained on shutdown
+func (srv *server) spawn(task func()) {
+	srv.tasks.Add(1)
+	go func() {
+		defer srv.tasks.Done()
+		task()
+	}()
+}
+
+// Shuts the server down because of err, the first error wins
+func (srv *server) fail(err error) {
+	select {
+	case srv.failed <- err:
+	default:
+	}
+}
+
+// Blocks until the process is told to stop or a task fails, then shuts down in
+// order: no new work is scheduled, the requests, scrapes and workers in
+// progress are drained, their writes are published and the databases closed.
+// The requests get ShutdownTimeout to finish, then the rest of the work gets
+// as much again. Returns nil only if the shutdown was clean.
+func (srv *server) waitForShutdown() error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, os.Interrupt)
+	var err error
+	select {
+	case sig := <-ch:
+		log.Println("Shutting down on", sig)
+	case err = <-srv.failed:
+		log.Println("Shutting down:", err)
+	}
+	srv.stop()
+
+	// The API bounds its own shutdown by ShutdownTimeout, the drain of the
+	// rest only starts counting once it stopped serving
+	if srv.apiDone != nil {
+		select {
+		case <-srv.apiDone:
+		case sig := <-ch:
+			return fmt.Errorf("shutdown interrupted by %v, exiting without closing the databases", sig)
+		}
+	}
+
+	drained := make(chan bool)
+	go func() {
+		srv.tasks.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(srv.cfg.ShutdownTimeout):
+		// Bolt survives being stopped mid-write, closing it under a writer would block
+		return fmt.Errorf("work still in progress after %v, exiting without closing the databases", srv.cfg.ShutdownTimeout)
+	case sig := <-ch:
+		return fmt.Errorf("shutdown interrupted by %v, exiting without closing the databases", sig)
+	}
+
+	// Hand the last scraped data to the API processes
+	if srv.publisher != nil {
+		if _, err := srv.publisher.Publish(); err != nil {
+			log.Println("Publish:", err)
+		}
+	}
+	// When closed make sure to call Close on all the underlying bolt.DB instances.
+	srv.close()
+	if err == nil {
+		log.Println("Shut down cleanly")
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hnews/config"
+	"testing"
+	"time"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	tests := []struct {
+		name     string
+		withAPI  bool
+		requests time.Duration // Time the API takes to stop serving
+		work     time.Duration // Time the work takes after the API stopped
+		clean    bool
+	}{
+		{"each within the timeout", true, 70 * time.Millisecond, 70 * time.Millisecond, true},
+		{"work too slow", true, 10 * time.Millisecond, 3 * timeout, false},
+		{"without an API", false, 0, 70 * time.Millisecond, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := new(server)
+			srv.cfg = &config.Config{ShutdownTimeout: timeout}
+			srv.ctx, srv.stop = context.WithCancel(context.Background())
+			srv.failed = make(chan error, 1)
+
+			apiDone := make(chan struct{})
+			if test.withAPI {
+				srv.apiDone = apiDone
+				srv.spawn(func() {
+					defer close(apiDone)
+					<-srv.ctx.Done()
+					time.Sleep(test.requests)
+				})
+			} else {
+				close(apiDone)
+			}
+			srv.spawn(func() {
+				<-srv.ctx.Done()
+				<-apiDone
+				time.Sleep(test.work)
+			})
+
+			stop := errors.New("stop")
+			srv.fail(stop)
+			err := srv.waitForShutdown()
+			if clean := err == stop; clean != test.clean {
+				t.Errorf("waitForShutdown = %v, want clean %v", err, test.clean)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hnews/ranking"
+	"hnews/scraper"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is every setting of the server. Each setting is read from, in order
+// of precedence, a flag, an environment variable, the config file and the
+// default. The flag -max-limit is the environment variable HNEWS_MAX_LIMIT and
+// the key max_limit in the file.
+type Config struct {
+	File string // Path of the JSON config file, if any
+
+	Port            string // Port the API listens on
+	Debug           bool
+	ShutdownTimeout time.Duration // Most time spent draining the requests, then as much again for the workers, on shutdown
+
+	DataDir          string // Directory the databases are stored in
+	ThumbnailDir     string // Relative to DataDir unless absolute
+	SessionKeyFile   string // Relative to DataDir unless absolute
+	SessionSecret    string // Overrides the key in SessionKeyFile
+	SnapshotDir      string // Shared by scrape and serve when run as separate processes
+	SnapshotInterval time.Duration
+
+	SessionIdle     time.Duration
+	SessionMaxAge   time.Duration
+	LegacyQueryAuth bool
+	MaxLimit        int
+
+	Pages              int                          // Pages of every list scraped each cycle, only if set
+	ScrapeInterval     time.Duration                // Least time between two scrape cycles of every list, only if set
+	Schedules          map[string]*scraper.Schedule // Schedule of each list by name, only the parts that are set
+	ScrapeRetryTimeout time.Duration
+	HNTimeout          time.Duration
+	HNRetryTimeout     time.Duration
+	Track              time.Duration
+	History            time.Duration // How long the Samples of the news and the snapshots of the lists are kept
+	Backfill           int
+	EnrichInterval     time.Duration
+	NotifyInterval     time.Duration
+
+	Ranking ranking.Params
+
+	set map[string]bool // Names of the settings that were set rather than defaulted
+}
+
+// Environment variables read besides the HNEWS_ ones, for compatibility
+var envAliases = map[string]string{
+	"port":           "PORT",
+	"session-secret": "SESSION_SECRET",
+}
+
+// Settings that are never printed
+var secrets = map[string]bool{"session-secret": true}
+
+// Default returns the Config used when nothing is configured.
+func Default() *Config {
+	cfg := new(Config)
+	cfg.Port = "8080"
+	cfg.Debug = true
+	cfg.ShutdownTimeout = 30 * time.Second
+	cfg.DataDir = "."
+	cfg.ThumbnailDir = "thumbnails"
+	cfg.SessionKeyFile = "sessions.key"
+	cfg.SnapshotInterval = time.Minute
+	cfg.SessionIdle = 30 * 24 * time.Hour
+	cfg.SessionMaxAge = 90 * 24 * time.Hour
+	cfg.MaxLimit = 100
+	cfg.Pages = 16
+	cfg.Schedules = make(map[string]*scraper.Schedule)
+	for _, resource := range scraper.Resources {
+		schedule := resource.Schedule
+		cfg.Schedules[resource.Name] = &schedule
+	}
+	cfg.ScrapeRetryTimeout = 15 * time.Minute
+	cfg.HNTimeout = 20 * time.Second
+	cfg.HNRetryTimeout = 10 * time.Second
+	cfg.Track = 48 * time.Hour
+	cfg.History = 90 * 24 * time.Hour
+	cfg.EnrichInterval = time.Second
+	cfg.NotifyInterval = 10 * time.Minute
+	cfg.Ranking = ranking.DefaultParams
+	return cfg
+}
+
+// Registers a flag bound to each setting, defaulting to its current value
+func (cfg *Config) flags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Port, "port", cfg.Port, "Port the API listens on.")
+	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Debug mode, defaults to true.")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "Most time spent finishing the requests in progress on shutdown, then as much again for the scrapes and writes.")
+	fs.StringVar(&cfg.DataDir, "data-dir", cfg.DataDir, "Directory the databases are stored in.")
+	fs.StringVar(&cfg.ThumbnailDir, "thumbnail-dir", cfg.ThumbnailDir, "Directory the thumbnails of the news are stored in.")
+	fs.StringVar(&cfg.SessionKeyFile, "session-key-file", cfg.SessionKeyFile, "File the generated session key is stored in.")
+	fs.StringVar(&cfg.SessionSecret, "session-secret", cfg.SessionSecret, "Secret the session key is derived from instead of the key file.")
+	fs.StringVar(&cfg.SnapshotDir, "snapshot-dir", cfg.SnapshotDir, "Directory scrape publishes the data in and serve reads it from, to run them as separate processes.")
+	fs.DurationVar(&cfg.SnapshotInterval, "snapshot-interval", cfg.SnapshotInterval, "Time between each publish of the data to the snapshot directory.")
+	fs.DurationVar(&cfg.SessionIdle, "session-idle", cfg.SessionIdle, "Sessions not used for this long expire.")
+	fs.DurationVar(&cfg.SessionMaxAge, "session-max-age", cfg.SessionMaxAge, "Sessions expire this long after login.")
+	fs.BoolVar(&cfg.LegacyQueryAuth, "legacy-query-auth", cfg.LegacyQueryAuth, "Deprecated: Accept API keys and write payloads in the query string.")
+	fs.IntVar(&cfg.MaxLimit, "max-limit", cfg.MaxLimit, "Most items returned in one page of a list.")
+	fs.IntVar(&cfg.Pages, "pages", cfg.Pages, "Pages of every list scraped each cycle, if set, instead of the pages of each list.")
+	fs.DurationVar(&cfg.ScrapeInterval, "scrape-interval", cfg.ScrapeInterval, "Least time between two scrape cycles of every list, if set, 0 scrapes continuously.")
+	for _, resource := range scraper.Resources {
+		schedule := cfg.Schedules[resource.Name]
+		fs.IntVar(&schedule.Pages, resource.Name+"-pages", schedule.Pages, "Pages of the "+resource.Name+" list scraped each cycle, overrides -pages.")
+		fs.DurationVar(&schedule.Interval, resource.Name+"-scrape-interval", schedule.Interval, "Least time between two scrape cycles of the "+resource.Name+" list, overrides -scrape-interval.")
+	}
+	fs.DurationVar(&cfg.ScrapeRetryTimeout, "scrape-retry-timeout", cfg.ScrapeRetryTimeout, "Most time spent retrying a page while Hacker News is busy.")
+	fs.DurationVar(&cfg.HNTimeout, "hn-timeout", cfg.HNTimeout, "Most time a request on behalf of a user may take.")
+	fs.DurationVar(&cfg.HNRetryTimeout, "hn-retry-timeout", cfg.HNRetryTimeout, "Most time spent retrying a request on behalf of a user.")
+	fs.DurationVar(&cfg.Track, "track", cfg.Track, "How long to keep tracking news after they leave the lists.")
+	fs.DurationVar(&cfg.History, "history", cfg.History, "How long the samples of the news and the snapshots of the lists are kept.")
+	fs.IntVar(&cfg.Backfill, "backfill", cfg.Backfill, "Number of days of front pages to backfill into the archive.")
+	fs.DurationVar(&cfg.EnrichInterval, "enrich-interval", cfg.EnrichInterval, "Time to wait between each request when enriching links.")
+	fs.DurationVar(&cfg.NotifyInterval, "notify-interval", cfg.NotifyInterval, "Time between checks for replies to logged in users, 0 disables notifications.")
+	fs.Float64Var(&cfg.Ranking.Gravity, "gravity", cfg.Ranking.Gravity, "How fast trending scores decay with age.")
+	fs.Float64Var(&cfg.Ranking.VelocityWeight, "velocity-weight", cfg.Ranking.VelocityWeight, "Hours of velocity added to the points of trending news.")
+	fs.Float64Var(&cfg.Ranking.CommentWeight, "comment-weight", cfg.Ranking.CommentWeight, "Points a comment per hour is worth in the velocity.")
+	fs.DurationVar(&cfg.Ranking.Window, "velocity-window", cfg.Ranking.Window, "How far back samples are used for velocities.")
+}
+
+// Load reads the Config from the file given by -config or HNEWS_CONFIG, the
+// environment and the flags in args, and validates it. The flags of the
+// settings are added to fs, which may have flags of its own.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	// The flags are parsed first to find the file but applied last
+	file := fs.String("config", os.Getenv("HNEWS_CONFIG"), "JSON file the settings are read from, see the config command.")
+	Default().flags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("config: unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg := Default()
+	cfg.File = *file
+	settings := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	cfg.flags(settings)
+	if cfg.File != "" {
+		if err := loadFile(settings, cfg.File); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadEnv(settings); err != nil {
+		return nil, err
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if settings.Lookup(f.Name) != nil && err == nil {
+			err = settings.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.set = make(map[string]bool)
+	settings.Visit(func(f *flag.Flag) {
+		cfg.set[f.Name] = true
+	})
+	return cfg, cfg.Validate()
+}
+
+// Reads the settings in the JSON file, the keys are the names of the flags
+// with underscores, e.g. {"max_limit": 50, "track": "24h"}
+func loadFile(settings *flag.FlagSet, path string) error {
+	if ext := filepath.Ext(path); ext != ".json" {
+		return fmt.Errorf("config: %s is not a JSON file, only JSON config files are supported", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("config: %s: %v", path, err)
+	}
+
+	for key, value := range values {
+		f := settings.Lookup(strings.Replace(key, "_", "-", -1))
+		if f == nil {
+			return fmt.Errorf("config: %s: unknown setting %q", path, key)
+		}
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case bool:
+			text = strconv.FormatBool(v)
+		case float64:
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("config: %s: %s must be a string, number or boolean", path, key)
+		}
+		if err := settings.Set(f.Name, text); err != nil {
+			return fmt.Errorf("config: %s: %s: invalid value %q: %v", path, key, text, err)
+		}
+	}
+	return nil
+}
+
+// Reads the settings in HNEWS_ environment variables and their aliases
+func loadEnv(settings *flag.FlagSet) error {
+	var err error
+	settings.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		name := EnvName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if alias, hasAlias := envAliases[f.Name]; !ok && hasAlias {
+			name = alias
+			value, ok = os.LookupEnv(alias)
+		}
+		if ok && value != "" {
+			if setErr := settings.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("config: $%s: invalid value %q: %v", name, value, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// EnvName returns the environment variable of the setting with the flag name.
+func EnvName(name string) string {
+	return "HNEWS_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// Validate returns an error listing every setting that is out of range.
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(cfg.Port)
+	check(err == nil && port > 0 && port < 1<<16, "port must be a number from 1 to 65535, got %q", cfg.Port)
+	check(cfg.ShutdownTimeout > 0, "shutdown_timeout must be positive, got %v", cfg.ShutdownTimeout)
+	check(cfg.DataDir != "", "data_dir must not be empty")
+	check(cfg.ThumbnailDir != "", "thumbnail_dir must not be empty")
+	check(cfg.SessionKeyFile != "" || cfg.SessionSecret != "", "session_key_file or session_secret must be set")
+	check(cfg.SnapshotInterval > 0, "snapshot_interval must be positive, got %v", cfg.SnapshotInterval)
+	check(cfg.SessionIdle > 0, "session_idle must be positive, got %v", cfg.SessionIdle)
+	check(cfg.SessionMaxAge >= cfg.SessionIdle, "session_max_age must be at least session_idle, got %v", cfg.SessionMaxAge)
+	check(cfg.MaxLimit > 0, "max_limit must be at least 1, got %d", cfg.MaxLimit)
+	check(cfg.Pages > 0, "pages must be at least 1, got %d", cfg.Pages)
+	check(cfg.ScrapeInterval >= 0, "scrape_interval must not be negative, got %v", cfg.ScrapeInterval)
+	for _, resource := range scraper.Resources {
+		schedule := cfg.Schedules[resource.Name]
+		check(schedule.Pages > 0, "%s_pages must be at least 1, got %d", resource.Name, schedule.Pages)
+		check(schedule.Interval >= 0, "%s_scrape_interval must not be negative, got %v", resource.Name, schedule.Interval)
+	}
+	check(cfg.ScrapeRetryTimeout >= 0, "scrape_retry_timeout must not be negative, got %v", cfg.ScrapeRetryTimeout)
+	check(cfg.HNTimeout > 0, "hn_timeout must be positive, got %v", cfg.HNTimeout)
+	check(cfg.HNRetryTimeout >= 0, "hn_retry_timeout must not be negative, got %v", cfg.HNRetryTimeout)
+	check(cfg.Track >= 0, "track must not be negative, got %v", cfg.Track)
+	check(cfg.History >= cfg.Track, "history must be at least track, got %v", cfg.History)
+	check(cfg.History >= cfg.Ranking.Window, "history must be at least velocity_window, got %v", cfg.History)
+	check(cfg.Backfill >= 0, "backfill must not be negative, got %d", cfg.Backfill)
+	check(cfg.EnrichInterval > 0, "enrich_interval must be positive, got %v", cfg.EnrichInterval)
+	check(cfg.NotifyInterval >= 0, "notify_interval must not be negative, got %v", cfg.NotifyInterval)
+	check(cfg.Ranking.Gravity > 0, "gravity must be positive, got %v", cfg.Ranking.Gravity)
+	check(cfg.Ranking.VelocityWeight >= 0, "velocity_weight must not be negative, got %v", cfg.Ranking.VelocityWeight)
+	check(cfg.Ranking.CommentWeight >= 0, "comment_weight must not be negative, got %v", cfg.Ranking.CommentWeight)
+	check(cfg.Ranking.Window > 0, "velocity_window must be positive, got %v", cfg.Ranking.Window)
+
+	if len(problems) > 0 {
+		return errors.New("config: invalid settings:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Schedule returns the Schedule of the list with the given name. The declared
+// Schedule of the list is kept unless -pages and -scrape-interval, or the
+// settings of the list such as -top-pages, were set.
+func (cfg *Config) Schedule(list string, declared scraper.Schedule) scraper.Schedule {
+	schedule := declared
+	if cfg.set["pages"] {
+		schedule.Pages = cfg.Pages
+	}
+	if cfg.set["scrape-interval"] {
+		schedule.Interval = cfg.ScrapeInterval
+	}
+	if own, ok := cfg.Schedules[list]; ok {
+		if cfg.set[list+"-pages"] {
+			schedule.Pages = own.Pages
+		}
+		if cfg.set[list+"-scrape-interval"] {
+			schedule.Interval = own.Interval
+		}
+	}
+	return schedule
+}
+
+// Path returns the path of a file or directory setting, relative paths are
+// relative to DataDir.
+func (cfg *Config) Path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(cfg.DataDir, path)
+}
+
+// Print writes the settings as a JSON config file with the secrets redacted.
+func (cfg *Config) Print(w io.Writer) error {
+	settings := flag.NewFlagSet("", flag.ContinueOnError)
+	copied := *cfg
+	copied.flags(settings)
+
+	values := make(map[string]interface{})
+	settings.VisitAll(func(f *flag.Flag) {
+		key := strings.Replace(f.Name, "-", "_", -1)
+		value := f.Value.(flag.Getter).Get()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case string:
+			if secrets[f.Name] && v != "" {
+				value = "<redacted>"
+			}
+		}
+		values[key] = value
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(values)
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"flag"
+	"hnews/scraper"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	declared := scraper.Schedule{Pages: 16, Interval: time.Minute}
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		top  scraper.Schedule
+		ask  scraper.Schedule
+	}{
+		{"declared", nil, nil, declared, declared},
+		{"every list", []string{"-pages=4", "-scrape-interval=5m"}, nil,
+			scraper.Schedule{Pages: 4, Interval: 5 * time.Minute}, scraper.Schedule{Pages: 4, Interval: 5 * time.Minute}},
+		{"one list", []string{"-ask-pages=2"}, nil, declared, scraper.Schedule{Pages: 2, Interval: time.Minute}},
+		{"list over every list", []string{"-pages=4", "-ask-pages=2"}, nil,
+			scraper.Schedule{Pages: 4, Interval: time.Minute}, scraper.Schedule{Pages: 2, Interval: time.Minute}},
+		{"environment", nil, map[string]string{"HNEWS_TOP_SCRAPE_INTERVAL": "0s"}, scraper.Schedule{Pages: 16}, declared},
+	}
+	for _, test := range tests {
+		for name, value := range test.env {
+			t.Setenv(name, value)
+		}
+		cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), test.args)
+		if err != nil {
+			t.Fatalf("%s: Load: %v", test.name, err)
+		}
+		if got := cfg.Schedule("top", declared); got != test.top {
+			t.Errorf("%s: Schedule of top = %+v, want %+v", test.name, got, test.top)
+		}
+		if got := cfg.Schedule("ask", declared); got != test.ask {
+			t.Errorf("%s: Schedule of ask = %+v, want %+v", test.name, got, test.ask)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := [][]string{
+		{"-port=0"},
+		{"-enrich-interval=0"},
+		{"-top-pages=0"},
+		{"-newest-scrape-interval=-1s"},
+		{"-shutdown-timeout=0"},
+	}
+	for _, args := range tests {
+		if _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), args); err == nil {
+			t.Errorf("Load(%q) is valid, want an error", args)
+		}
+	}
+}
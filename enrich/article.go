@@ -0,0 +1,373 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hnews/services"
+	"log"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Articles are extracted again once they are older than this
+const rereadAfter = 24 * time.Hour
+
+// Words read per minute when estimating the reading time
+const wordsPerMinute = 200
+
+// Paragraphs shorter than this are not scored
+const minParagraphLength = 25
+
+// ErrNoContent is returned when no main content could be found on a page
+var ErrNoContent = errors.New("enrich: no content found")
+
+// Classes and ids that hint whether an element is the main content or not
+var (
+	positiveHint = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	negativeHint = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|sponsor|promo|related|share|social|nav|menu|banner|ad-|popup|cookie`)
+	bylineHint   = regexp.MustCompile(`(?i)byline|author|writtenby`)
+)
+
+// Elements that never are part of the main content
+var removed = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Svg: true, atom.Object: true,
+	atom.Embed: true, atom.Select: true, atom.Input: true, atom.Textarea: true,
+}
+
+// Elements kept in the sanitized HTML, all others are replaced by their children
+var allowed = map[atom.Atom]bool{
+	atom.P: true, atom.Br: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Ul: true, atom.Ol: true, atom.Li: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Code: true, atom.Em: true,
+	atom.I: true, atom.Strong: true, atom.B: true, atom.A: true, atom.Img: true,
+	atom.Figure: true, atom.Figcaption: true,
+}
+
+// Elements that start a new paragraph in the plain text
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Li: true, atom.Blockquote: true,
+	atom.Pre: true, atom.Figcaption: true, atom.Div: true, atom.Section: true,
+}
+
+// Reader extracts the articles linked by News in the background.
+type Reader struct {
+	MaxRank int32 // Only News ranked this high are read
+
+	client *Client
+	queue  *queue
+}
+
+// NewReader creates a Reader fetching with the given Client.
+func NewReader(client *Client) *Reader {
+	reader := new(Reader)
+	reader.MaxRank = 60
+	reader.client = client
+	reader.queue = newQueue()
+	return reader
+}
+
+// Enqueue queues the News that have not been read recently, never blocks.
+func (reader *Reader) Enqueue(news []services.News) {
+	for _, aNews := range news {
+		if aNews.ID == 0 || aNews.Rank > reader.MaxRank || !isExternal(aNews.Link) {
+			continue
+		}
+		if article, ok := services.ReadArticle(int(aNews.ID)); ok && time.Since(article.FetchedAt) < rereadAfter {
+			continue
+		}
+		if !reader.queue.push(aNews) {
+			return // Full, try again next cycle
+		}
+	}
+}
+
+// Start reads the queued News until ctx is done, run as a goroutine.
+func (reader *Reader) Start(ctx context.Context, debug bool) {
+	reader.queue.run(ctx, func(aNews services.News) {
+		root, pageURL, err := reader.client.GetHTML(ctx, aNews.Link)
+		if err != nil {
+			if debug {
+				log.Println("Read:", err)
+			}
+			return
+		}
+		article, err := ExtractArticle(root, pageURL)
+		if err != nil {
+			if debug {
+				log.Println("Read:", aNews.Link, err)
+			}
+			return
+		}
+		article.NewsID = aNews.ID
+		if err := services.SaveArticle(article); err != nil {
+			log.Println("Read:", aNews.Link, err)
+		}
+	})
+}
+
+// ExtractArticle finds the main content of the page fetched from pageURL and
+// returns it as sanitized HTML and plain text, cut to fit MaxArticleBytes.
+func ExtractArticle(root *html.Node, pageURL string) (services.Article, error) {
+	meta := ParseMeta(root, pageURL)
+	article := services.Article{URL: meta.URL, Title: meta.Title, FetchedAt: time.Now()}
+	article.Byline = parseByline(root)
+
+	strip(root)
+	content := bestCandidate(root)
+	if content == nil {
+		return article, ErrNoContent
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		base = new(url.URL)
+	}
+
+	// Render one top level child at a time so that the content is only cut between elements
+	budget := services.MaxArticleBytes
+	var htmlBuf, textBuf bytes.Buffer
+	for child := content.FirstChild; child != nil; child = child.NextSibling {
+		var h, t bytes.Buffer
+		renderHTML(&h, child, base)
+		renderText(&t, child)
+		if htmlBuf.Len()+h.Len()+textBuf.Len()+t.Len() > budget {
+			article.Truncated = true
+			break
+		}
+		htmlBuf.Write(h.Bytes())
+		textBuf.Write(t.Bytes())
+	}
+
+	article.HTML = strings.TrimSpace(htmlBuf.String())
+	article.Text = collapseParagraphs(textBuf.String())
+	if article.Text == "" {
+		return article, ErrNoContent
+	}
+	article.Words = len(strings.Fields(article.Text))
+	article.ReadingTime = int(math.Ceil(float64(article.Words) / wordsPerMinute))
+	return article, nil
+}
+
+// Returns the author from the meta tags or an element hinted as the byline
+func parseByline(root *html.Node) string {
+	authorMatcher := func(n *html.Node) bool {
+		return n.DataAtom == atom.Meta && strings.ToLower(scrape.Attr(n, "name")) == "author"
+	}
+	if node, ok := scrape.Find(root, authorMatcher); ok && scrape.Attr(node, "content") != "" {
+		return strings.TrimSpace(scrape.Attr(node, "content"))
+	}
+
+	bylineMatcher := func(n *html.Node) bool {
+		if n.Type != html.ElementNode || n.DataAtom == atom.Meta || n.DataAtom == atom.Link {
+			return false
+		}
+		return scrape.Attr(n, "rel") == "author" || bylineHint.MatchString(scrape.Attr(n, "class")+" "+scrape.Attr(n, "id"))
+	}
+	if node, ok := scrape.Find(root, bylineMatcher); ok {
+		byline := strings.Join(strings.Fields(scrape.Text(node)), " ")
+		if len(byline) > 0 && len(byline) < 100 {
+			return byline
+		}
+	}
+	return ""
+}
+
+// Removes the elements that never are part of the main content
+func strip(node *html.Node) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.CommentNode || (child.Type == html.ElementNode && removed[child.DataAtom]) {
+			node.RemoveChild(child)
+		} else {
+			strip(child)
+		}
+		child = next
+	}
+}
+
+// Scores each paragraph and gives the score to its parent and half of it to
+// its grandparent, the element with the highest score is the main content.
+func bestCandidate(root *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	paragraphMatcher := func(n *html.Node) bool {
+		return n.DataAtom == atom.P || n.DataAtom == atom.Pre || n.DataAtom == atom.Td || n.DataAtom == atom.Blockquote
+	}
+	for _, paragraph := range scrape.FindAll(root, paragraphMatcher) {
+		text := scrape.Text(paragraph)
+		if len(text) < minParagraphLength || paragraph.Parent == nil {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+
+		parent := paragraph.Parent
+		if _, ok := scores[parent]; !ok {
+			scores[parent] = hintScore(parent)
+		}
+		scores[parent] += score
+
+		if grandparent := parent.Parent; grandparent != nil && grandparent.Type == html.ElementNode {
+			if _, ok := scores[grandparent]; !ok {
+				scores[grandparent] = hintScore(grandparent)
+			}
+			scores[grandparent] += score / 2
+		}
+	}
+
+	var best *html.Node
+	bestScore := 0.0
+	for node, score := range scores {
+		score *= 1 - linkDensity(node)
+		if score > bestScore {
+			best = node
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// Scores an element by its tag, class and id
+func hintScore(node *html.Node) float64 {
+	var score float64
+	switch node.DataAtom {
+	case atom.Article:
+		score += 10
+	case atom.Div, atom.Section:
+		score += 5
+	case atom.Ol, atom.Ul, atom.Dl, atom.Li:
+		score -= 3
+	case atom.Body:
+		score -= 5
+	}
+	if node.Data == "main" {
+		score += 10
+	}
+	hints := scrape.Attr(node, "class") + " " + scrape.Attr(node, "id")
+	if positiveHint.MatchString(hints) {
+		score += 25
+	}
+	if negativeHint.MatchString(hints) {
+		score -= 25
+	}
+	return score
+}
+
+// Returns the share of the text of the element that is in links
+func linkDensity(node *html.Node) float64 {
+	length := len(scrape.Text(node))
+	if length == 0 {
+		return 0
+	}
+	var linkLength int
+	for _, link := range scrape.FindAll(node, scrape.ByTag(atom.A)) {
+		linkLength += len(scrape.Text(link))
+	}
+	return float64(linkLength) / float64(length)
+}
+
+// Writes the element with only the allowed elements and attributes
+func renderHTML(buf *bytes.Buffer, node *html.Node, base *url.URL) {
+	switch node.Type {
+	case html.TextNode:
+		buf.WriteString(html.EscapeString(node.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	tag := node.DataAtom
+	if tag == atom.H1 {
+		tag = atom.H2 // The title is the only h1
+	}
+	if !allowed[tag] {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			renderHTML(buf, child, base)
+		}
+		return
+	}
+
+	switch tag {
+	case atom.Img:
+		if src := safeURL(base, scrape.Attr(node, "src")); src != "" {
+			buf.WriteString(`<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(scrape.Attr(node, "alt")) + `">`)
+		}
+		return
+	case atom.Br:
+		buf.WriteString("<br>")
+		return
+	}
+
+	buf.WriteString("<" + tag.String())
+	if tag == atom.A {
+		if href := safeURL(base, scrape.Attr(node, "href")); href != "" {
+			buf.WriteString(` href="` + html.EscapeString(href) + `"`)
+		}
+	}
+	buf.WriteString(">")
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		renderHTML(buf, child, base)
+	}
+	buf.WriteString("</" + tag.String() + ">")
+}
+
+// Writes the text of the element with blank lines between paragraphs
+func renderText(buf *bytes.Buffer, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		buf.WriteString(node.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if node.DataAtom == atom.Br {
+		buf.WriteString("\n")
+		return
+	}
+	block := blocks[node.DataAtom]
+	if block {
+		buf.WriteString("\n\n")
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		renderText(buf, child)
+	}
+	if block {
+		buf.WriteString("\n\n")
+	}
+}
+
+// Collapses the whitespace of each paragraph and separates them by one blank line
+func collapseParagraphs(text string) string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.Join(strings.Fields(paragraph), " ")
+		if paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// Resolves ref against base and returns it if it is a http(s) URL
+func safeURL(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	u = base.ResolveReference(u)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,66 @@
+package enrich
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const articlePage = `<html><head><title>T</title><meta name="author" content="Jane Doe"></head><body>
+<nav>menu <a href="/">home</a> <a href="/about">about</a></nav>
+<div class="article-body"><h1>Hello</h1>
+<p>This is a long paragraph, with commas, and more text to score it well enough to be the content.</p>
+<p>Second paragraph <a href="/x">link</a> <a href="javascript:bad()">bad</a> <img src="javascript:bad"><img src="/i.png"> and the text goes on for a while here.</p>
+<script>steal()</script><p onclick="steal()">Third paragraph, which has an event handler, and then some more words.</p></div>
+<div class="sidebar"><p>Related stuff goes here and is fairly long as well, yes it is.</p></div></body></html>`
+
+func TestExtractArticle(t *testing.T) {
+	article, err := ExtractArticle(parse(t, articlePage), "https://example.com/post/1")
+	if err != nil {
+		t.Fatalf("ExtractArticle: %v", err)
+	}
+	if article.Byline != "Jane Doe" {
+		t.Errorf("Byline = %q, want Jane Doe", article.Byline)
+	}
+	for _, want := range []string{"long paragraph", "Second paragraph", `href="https://example.com/x"`, `src="https://example.com/i.png"`} {
+		if !strings.Contains(article.HTML, want) {
+			t.Errorf("HTML is missing %q:\n%s", want, article.HTML)
+		}
+	}
+	for _, unwanted := range []string{"menu", "Related stuff", "javascript:", "<script", "steal", "onclick"} {
+		if strings.Contains(article.HTML, unwanted) {
+			t.Errorf("HTML contains %q:\n%s", unwanted, article.HTML)
+		}
+	}
+	if strings.Contains(article.Text, "<") || !strings.Contains(article.Text, "Third paragraph") {
+		t.Errorf("Text = %q, want the plain text of the paragraphs", article.Text)
+	}
+	if article.Words == 0 || article.ReadingTime != 1 {
+		t.Errorf("Words = %d, ReadingTime = %d, want some words read in a minute", article.Words, article.ReadingTime)
+	}
+}
+
+func TestExtractArticleWithoutContent(t *testing.T) {
+	if _, err := ExtractArticle(parse(t, `<html><body><nav><a href="/">home</a></nav></body></html>`), "https://example.com/"); err != ErrNoContent {
+		t.Errorf("ExtractArticle of an empty page = %v, want %v", err, ErrNoContent)
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	base, _ := url.Parse("https://example.com/post/1")
+	tests := []struct {
+		ref, want string
+	}{
+		{"/a", "https://example.com/a"},
+		{"b", "https://example.com/post/b"},
+		{"https://other.com/c", "https://other.com/c"},
+		{"javascript:alert(1)", ""},
+		{"data:text/html,hi", ""},
+		{" JavaScript:alert(1)", ""},
+	}
+	for _, test := range tests {
+		if got := safeURL(base, test.ref); got != test.want {
+			t.Errorf("safeURL(%q) = %q, want %q", test.ref, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// UserAgent is sent with every request made to the sites News links to
+const UserAgent = "H-News-Backend (+https://h-news.herokuapp.com)"
+
+// Client is a HTTP client that makes at most one request per interval so
+// that we are nice to the sites we enrich links from.
+type Client struct {
+	MaxBytes int64 // Bodies are truncated at this many bytes
+
+	client  *http.Client
+	limiter <-chan time.Time
+}
+
+// NewClient creates a Client waiting interval between each request, an
+// interval of 0 does not wait at all.
+func NewClient(interval time.Duration) *Client {
+	client := new(Client)
+	client.MaxBytes = 2 << 20
+	client.client = &http.Client{Transport: publicTransport(), Timeout: 15 * time.Second}
+	if interval > 0 {
+		client.limiter = time.Tick(interval)
+	}
+	return client
+}
+
+// ErrTooLarge is returned by GetAll when a body is larger than allowed
+var ErrTooLarge = errors.New("enrich: body too large")
+
+// ErrNotPublic is returned when a link or one of its redirects points to an
+// address that isn't on the public internet, e.g. our own network.
+var ErrNotPublic = errors.New("enrich: address is not public")
+
+// The ranges that aren't reachable on the public internet besides the
+// loopback, private, link-local, multicast and unspecified addresses.
+var reservedNets = parseCIDRs(
+	"0.0.0.0/8",     // This network
+	"100.64.0.0/10", // Carrier-grade NAT
+	"192.0.0.0/24",  // Protocol assignments
+	"198.18.0.0/15", // Benchmarking
+	"240.0.0.0/4",   // Reserved, including the broadcast address
+	"64:ff9b::/96",  // IPv4 translation, which may reach any of the above
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, nets[i], _ = net.ParseCIDR(cidr)
+	}
+	return nets
+}
+
+// Tells if ip is an address on the public internet
+func isPublic(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, reserved := range reservedNets {
+		if reserved.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Only connects to public addresses. The check runs on the address actually
+// dialed, so it covers the redirects and the names resolving to our own
+// network alike. Proxies are not used since they would be dialed instead.
+func publicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublic(net.ParseIP(host)) {
+				return ErrNotPublic
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// Get waits for its turn and then fetches the body of the page at url,
+// truncated at MaxBytes, and the URL it was fetched from after redirects.
+// Gives up as soon as ctx is done.
+func (client *Client) Get(ctx context.Context, url string, accept string) ([]byte, string, error) {
+	return client.get(ctx, url, accept, client.MaxBytes, true)
+}
+
+// GetAll is like Get but fails with ErrTooLarge instead of truncating bodies
+// larger than max bytes.
+func (client *Client) GetAll(ctx context.Context, url string, accept string, max int64) ([]byte, string, error) {
+	return client.get(ctx, url, accept, max, false)
+}
+
+func (client *Client) get(ctx context.Context, url string, accept string, max int64, truncate bool) ([]byte, string, error) {
+	if client.limiter != nil {
+		select {
+		case <-client.limiter:
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", accept)
+
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", errors.New("enrich: " + url + " responded " + resp.Status)
+	}
+	if !truncate && resp.ContentLength > max {
+		return nil, "", ErrTooLarge
+	}
+
+	// Read one byte more than allowed to tell if the body was too large
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(body)) > max {
+		if !truncate {
+			return nil, "", ErrTooLarge
+		}
+		body = body[:max]
+	}
+	return body, resp.Request.URL.String(), nil
+}
+
+// GetHTML fetches and parses the HTML page at url, see Get.
+func (client *Client) GetHTML(ctx context.Context, url string) (*html.Node, string, error) {
+	body, pageURL, err := client.Get(ctx, url, "text/html")
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := html.Parse(bytes.NewReader(body))
+	return root, pageURL, err
+}
@@ -0,0 +1,67 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"100.64.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, test := range tests {
+		if got := isPublic(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("isPublic(%s) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestGetRefusesLocalAddresses(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprint(w, "<html><head><title>Internal</title></head></html>")
+	}))
+	defer server.Close()
+
+	client := NewClient(0)
+	if _, _, err := client.Get(context.Background(), server.URL, "text/html"); !errors.Is(err, ErrNotPublic) {
+		t.Errorf("Get(%s) = %v, want %v", server.URL, err, ErrNotPublic)
+	}
+	if hits != 0 {
+		t.Errorf("the local server was requested %d times, want none", hits)
+	}
+}
+
+func TestGetGivesUpWhenDone(t *testing.T) {
+	client := NewClient(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := client.Get(ctx, "https://example.com/", "text/html"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get with a done context = %v, want %v", err, context.Canceled)
+	}
+}
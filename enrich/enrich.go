@@ -0,0 +1,73 @@
+package enrich
+
+import (
+	"context"
+	"hnews/services"
+	"log"
+	"strings"
+	"time"
+)
+
+// Links are enriched again once their metadata is older than this
+const refreshAfter = 24 * time.Hour
+
+// Enricher fetches the metadata of the links of News in the background.
+type Enricher struct {
+	client *Client
+	queue  *queue
+}
+
+// NewEnricher creates an Enricher fetching with the given Client.
+func NewEnricher(client *Client) *Enricher {
+	enricher := new(Enricher)
+	enricher.client = client
+	enricher.queue = newQueue()
+	return enricher
+}
+
+// Enqueue queues the News that have not been enriched recently, never blocks.
+func (enricher *Enricher) Enqueue(news []services.News) {
+	for _, aNews := range news {
+		if aNews.ID == 0 || !isExternal(aNews.Link) {
+			continue
+		}
+		if meta, ok := services.ReadLinkMeta(aNews.ID); ok && time.Since(meta.FetchedAt) < refreshAfter {
+			continue
+		}
+		if !enricher.queue.push(aNews) {
+			return // Full, try again next cycle
+		}
+	}
+}
+
+// Start enriches the queued News until ctx is done, run as a goroutine.
+func (enricher *Enricher) Start(ctx context.Context, debug bool) {
+	enricher.queue.run(ctx, func(aNews services.News) {
+		meta, err := enricher.fetchMeta(ctx, aNews.Link)
+		if ctx.Err() != nil {
+			return // Shutting down, the link is enriched on the next start
+		}
+		if err != nil {
+			if debug {
+				log.Println("Enrich:", err)
+			}
+			// Remember the failure so that the link is not retried every cycle
+			meta = services.LinkMeta{URL: aNews.Link, FetchedAt: time.Now()}
+		}
+		services.SaveLinkMeta(aNews.ID, meta)
+	})
+}
+
+func (enricher *Enricher) fetchMeta(ctx context.Context, link string) (services.LinkMeta, error) {
+	root, pageURL, err := enricher.client.GetHTML(ctx, link)
+	if err != nil {
+		return services.LinkMeta{}, err
+	}
+	return ParseMeta(root, pageURL), nil
+}
+
+// Self posts and links to Hacker News itself are not enriched
+func isExternal(link string) bool {
+	return (strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://")) &&
+		!strings.Contains(link, "://news.ycombinator.com/")
+}
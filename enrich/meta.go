@@ -0,0 +1,93 @@
+package enrich
+
+import (
+	"hnews/services"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ParseMeta parses the OpenGraph and Twitter card metadata of the page
+// fetched from pageURL, falling back on the plain HTML title and description.
+func ParseMeta(root *html.Node, pageURL string) services.LinkMeta {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		base = new(url.URL)
+	}
+
+	// Both property (OpenGraph) and name (Twitter, HTML) are used for meta tags
+	tags := make(map[string]string)
+	metaNodes := scrape.FindAll(root, scrape.ByTag(atom.Meta))
+	for _, node := range metaNodes {
+		key := scrape.Attr(node, "property")
+		if key == "" {
+			key = scrape.Attr(node, "name")
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		content := strings.TrimSpace(scrape.Attr(node, "content"))
+		if key == "" || content == "" {
+			continue
+		}
+		if _, ok := tags[key]; !ok {
+			tags[key] = content
+		}
+	}
+
+	meta := services.LinkMeta{FetchedAt: time.Now()}
+	meta.URL = resolve(base, first(tags["og:url"], pageURL))
+	meta.Title = first(tags["og:title"], tags["twitter:title"])
+	if meta.Title == "" {
+		if title, ok := scrape.Find(root, scrape.ByTag(atom.Title)); ok {
+			meta.Title = scrape.Text(title)
+		}
+	}
+	meta.Description = first(tags["og:description"], tags["twitter:description"], tags["description"])
+	meta.SiteName = first(tags["og:site_name"], tags["application-name"])
+	if image := first(tags["og:image:secure_url"], tags["og:image"], tags["twitter:image"], tags["twitter:image:src"]); image != "" {
+		meta.Image = resolve(base, image)
+	}
+	meta.Favicon = resolve(base, parseFavicon(root))
+	return meta
+}
+
+// Returns the href of the icon link of the page, or the default /favicon.ico
+func parseFavicon(root *html.Node) string {
+	matcher := func(n *html.Node) bool {
+		if n.DataAtom != atom.Link {
+			return false
+		}
+		for _, rel := range strings.Fields(strings.ToLower(scrape.Attr(n, "rel"))) {
+			if rel == "icon" {
+				return scrape.Attr(n, "href") != ""
+			}
+		}
+		return false
+	}
+	if node, ok := scrape.Find(root, matcher); ok {
+		return scrape.Attr(node, "href")
+	}
+	return "/favicon.ico"
+}
+
+// Resolves the possibly relative ref against base
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(u).String()
+}
+
+// Returns the first non-empty string
+func first(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package enrich
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func parse(t *testing.T, page string) *html.Node {
+	root, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("html.Parse: %v", err)
+	}
+	return root
+}
+
+func TestParseMeta(t *testing.T) {
+	tests := []struct {
+		name                               string
+		page                               string
+		title, description, image, favicon string
+	}{
+		{
+			"opengraph",
+			`<head><title>Plain</title><meta property="og:title" content="OG title"><meta property="og:description" content="OG description">
+			<meta property="og:image" content="/images/a.png"><link rel="shortcut icon" href="/static/icon.png"></head>`,
+			"OG title", "OG description", "https://example.com/images/a.png", "https://example.com/static/icon.png",
+		},
+		{
+			"twitter card",
+			`<head><meta name="twitter:title" content="Card title"><meta name="twitter:image" content="https://cdn.example.com/b.jpg"></head>`,
+			"Card title", "", "https://cdn.example.com/b.jpg", "https://example.com/favicon.ico",
+		},
+		{
+			"plain html",
+			`<head><title> Plain title </title><meta name="description" content="About the post"></head>`,
+			"Plain title", "About the post", "", "https://example.com/favicon.ico",
+		},
+		{
+			"first tag wins",
+			`<head><meta property="og:title" content="First"><meta property="og:title" content="Second"></head>`,
+			"First", "", "", "https://example.com/favicon.ico",
+		},
+	}
+	for _, test := range tests {
+		meta := ParseMeta(parse(t, test.page), "https://example.com/post/1")
+		if meta.Title != test.title || meta.Description != test.description || meta.Image != test.image || meta.Favicon != test.favicon {
+			t.Errorf("%s: ParseMeta = %q, %q, %q, %q, want %q, %q, %q, %q", test.name,
+				meta.Title, meta.Description, meta.Image, meta.Favicon, test.title, test.description, test.image, test.favicon)
+		}
+		if meta.URL != "https://example.com/post/1" {
+			t.Errorf("%s: URL = %q, want the page URL", test.name, meta.URL)
+		}
+	}
+}
+
+func TestIsExternal(t *testing.T) {
+	tests := []struct {
+		link string
+		want bool
+	}{
+		{"https://example.com/post", true},
+		{"http://example.com/post", true},
+		{"https://news.ycombinator.com/item?id=1", false},
+		{"item?id=1", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, test := range tests {
+		if got := isExternal(test.link); got != test.want {
+			t.Errorf("isExternal(%q) = %v, want %v", test.link, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package enrich
+
+import (
+	"context"
+	"hnews/services"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// Number of News that can be waiting in a queue before new ones are dropped
+const queueSize = 1024
+
+// A queue of News to be processed in the background, each News at most once
+// at a time.
+type queue struct {
+	ch chan services.News
+
+	mutex   sync.Mutex
+	pending map[int32]bool // ids of the News in ch or being processed
+}
+
+func newQueue() *queue {
+	q := new(queue)
+	q.ch = make(chan services.News, queueSize)
+	q.pending = make(map[int32]bool)
+	return q
+}
+
+// Queues the News unless it already is, returns false if the queue is full.
+func (q *queue) push(news services.News) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.pending[news.ID] {
+		return true
+	}
+	select {
+	case q.ch <- news:
+		q.pending[news.ID] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// Processes the queued News one at a time until ctx is done, the News still
+// queued then are dropped and queued again by the next cycle after a restart.
+func (q *queue) run(ctx context.Context, process func(news services.News)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case news := <-q.ch:
+			processSafely(process, news)
+			q.mutex.Lock()
+			delete(q.pending, news.ID)
+			q.mutex.Unlock()
+		}
+	}
+}
+
+// Processes one News, a panic on a page that could not be handled is logged
+// and the next News is processed
+func processSafely(process func(news services.News), news services.News) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Enrich: panic on", news.Link+":", r, "\n"+string(debug.Stack()))
+		}
+	}()
+	process(news)
+}
@@ -0,0 +1,216 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hnews/services"
+	"image"
+	"image/color"
+	_ "image/gif" // Registers the formats that can be decoded
+	"image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Failed thumbnails are retried once they are older than this
+const retryThumbnailAfter = 24 * time.Hour
+
+// Image formats thumbnails are generated from
+var thumbnailFormats = map[string]bool{"jpeg": true, "png": true, "gif": true}
+
+// ErrNoImage is returned when a page has no preview image
+var ErrNoImage = errors.New("enrich: no preview image")
+
+// ErrBadImage is returned when a preview image is of the wrong format or too large
+var ErrBadImage = errors.New("enrich: unsupported preview image")
+
+// Thumbnailer generates square JPEG thumbnails of the preview images of News
+// in the background and stores them content-addressed in Dir.
+type Thumbnailer struct {
+	Dir       string // Directory the thumbnails are stored in
+	Size      int    // Width and height of the thumbnails in pixels
+	Quality   int    // JPEG quality of the thumbnails
+	MaxBytes  int64  // Larger preview images are not downloaded
+	MaxPixels int    // Preview images with more pixels are not decoded
+
+	client *Client
+	queue  *queue
+}
+
+// NewThumbnailer creates a Thumbnailer storing thumbnails in dir and fetching
+// with the given Client.
+func NewThumbnailer(dir string, client *Client) *Thumbnailer {
+	thumbnailer := new(Thumbnailer)
+	thumbnailer.Dir = dir
+	thumbnailer.Size = 240
+	thumbnailer.Quality = 80
+	thumbnailer.MaxBytes = 5 << 20
+	thumbnailer.MaxPixels = 4096 * 4096
+	thumbnailer.client = client
+	thumbnailer.queue = newQueue()
+	return thumbnailer
+}
+
+// Path returns the path of the thumbnail with the given hash.
+func (thumbnailer *Thumbnailer) Path(hash string) string {
+	return filepath.Join(thumbnailer.Dir, hash[:2], hash+".jpg")
+}
+
+// Enqueue queues the News without thumbnails, never blocks.
+func (thumbnailer *Thumbnailer) Enqueue(news []services.News) {
+	for _, aNews := range news {
+		if aNews.ID == 0 || !isExternal(aNews.Link) {
+			continue
+		}
+		if thumbnail, ok := services.ReadThumbnail(int(aNews.ID)); ok {
+			if thumbnail.Hash != "" || time.Since(thumbnail.CreatedAt) < retryThumbnailAfter {
+				continue
+			}
+		}
+		if !thumbnailer.queue.push(aNews) {
+			return // Full, try again next cycle
+		}
+	}
+}
+
+// Start generates thumbnails for the queued News until ctx is done, run as a goroutine.
+func (thumbnailer *Thumbnailer) Start(ctx context.Context, debug bool) {
+	thumbnailer.queue.run(ctx, func(aNews services.News) {
+		thumbnail, err := thumbnailer.generate(ctx, aNews)
+		if ctx.Err() != nil {
+			return // Shutting down, the thumbnail is generated on the next start
+		}
+		if err != nil {
+			if debug {
+				log.Println("Thumbnail:", aNews.Link, err)
+			}
+			// Remember the failure so that the image is not retried every cycle
+			thumbnail.Hash = ""
+		}
+		thumbnail.CreatedAt = time.Now()
+		services.SaveThumbnail(aNews.ID, thumbnail)
+	})
+}
+
+func (thumbnailer *Thumbnailer) generate(ctx context.Context, news services.News) (services.Thumbnail, error) {
+	var thumbnail services.Thumbnail
+
+	// Use the preview image found when enriching the link if there is one
+	meta, ok := services.ReadLinkMeta(news.ID)
+	if !ok || meta.Image == "" {
+		root, pageURL, err := thumbnailer.client.GetHTML(ctx, news.Link)
+		if err != nil {
+			return thumbnail, err
+		}
+		meta = ParseMeta(root, pageURL)
+	}
+	if meta.Image == "" {
+		return thumbnail, ErrNoImage
+	}
+	thumbnail.Source = meta.Image
+
+	body, _, err := thumbnailer.client.GetAll(ctx, meta.Image, "image/jpeg, image/png, image/gif", thumbnailer.MaxBytes)
+	if err != nil {
+		return thumbnail, err
+	}
+
+	// Check the format and size before decoding so that huge images are never decoded
+	config, format, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return thumbnail, err
+	}
+	if !thumbnailFormats[format] || config.Width*config.Height > thumbnailer.MaxPixels {
+		return thumbnail, ErrBadImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return thumbnail, err
+	}
+
+	var buf bytes.Buffer
+	square := cropSquare(img.Bounds())
+	if err := jpeg.Encode(&buf, scale(img, square, thumbnailer.Size), &jpeg.Options{Quality: thumbnailer.Quality}); err != nil {
+		return thumbnail, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	thumbnail.Hash = hex.EncodeToString(sum[:])
+	return thumbnail, thumbnailer.store(thumbnail.Hash, buf.Bytes())
+}
+
+// Writes the thumbnail unless it is already stored, the same image is often
+// used by many News from the same site.
+func (thumbnailer *Thumbnailer) store(hash string, data []byte) error {
+	path := thumbnailer.Path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), hash)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), path)
+}
+
+// Returns the largest centered square within bounds
+func cropSquare(bounds image.Rectangle) image.Rectangle {
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > height {
+		x := bounds.Min.X + (width-height)/2
+		return image.Rect(x, bounds.Min.Y, x+height, bounds.Max.Y)
+	}
+	y := bounds.Min.Y + (height-width)/2
+	return image.Rect(bounds.Min.X, y, bounds.Max.X, y+width)
+}
+
+// Scales the area of img within src to a size by size opaque image by
+// averaging the source pixels covered by each destination pixel.
+func scale(img image.Image, src image.Rectangle, size int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	srcSize := src.Dx()
+	if srcSize == 0 {
+		return dst
+	}
+	for y := 0; y < size; y++ {
+		y0 := src.Min.Y + y*srcSize/size
+		y1 := src.Min.Y + (y+1)*srcSize/size
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < size; x++ {
+			x0 := src.Min.X + x*srcSize/size
+			x1 := src.Min.X + (x+1)*srcSize/size
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			// The colors are premultiplied, so this composites transparent images over white
+			white := 0xffff - a/n
+			dst.Set(x, y, color.RGBA64{uint16(r/n + white), uint16(g/n + white), uint16(b/n + white), 0xffff})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,85 @@
+package enrich
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCropSquare(t *testing.T) {
+	tests := []struct {
+		bounds, want image.Rectangle
+	}{
+		{image.Rect(0, 0, 100, 100), image.Rect(0, 0, 100, 100)},
+		{image.Rect(0, 0, 300, 100), image.Rect(100, 0, 200, 100)},
+		{image.Rect(0, 0, 100, 301), image.Rect(0, 100, 100, 200)},
+		{image.Rect(10, 20, 50, 30), image.Rect(25, 20, 35, 30)},
+	}
+	for _, test := range tests {
+		if got := cropSquare(test.bounds); got != test.want {
+			t.Errorf("cropSquare(%v) = %v, want %v", test.bounds, got, test.want)
+		}
+	}
+}
+
+// Returns an image of the size filled with c
+func filled(width, height int, c color.Color) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		size int
+		want color.RGBA
+	}{
+		{"down", filled(64, 64, color.NRGBA{200, 10, 10, 255}), 8, color.RGBA{200, 10, 10, 255}},
+		{"up", filled(4, 4, color.NRGBA{10, 200, 10, 255}), 16, color.RGBA{10, 200, 10, 255}},
+		{"transparent over white", filled(16, 16, color.NRGBA{0, 0, 0, 0}), 8, color.RGBA{255, 255, 255, 255}},
+	}
+	for _, test := range tests {
+		dst := scale(test.img, test.img.Bounds(), test.size)
+		if bounds := dst.Bounds(); bounds.Dx() != test.size || bounds.Dy() != test.size {
+			t.Errorf("%s: scaled to %v, want %d square", test.name, bounds, test.size)
+			continue
+		}
+		for _, p := range []image.Point{{0, 0}, {test.size - 1, test.size - 1}} {
+			if got := color.RGBAModel.Convert(dst.At(p.X, p.Y)); got != test.want {
+				t.Errorf("%s: pixel %v = %v, want %v", test.name, p, got, test.want)
+			}
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	thumbnailer := NewThumbnailer(t.TempDir(), NewClient(0))
+	hash := "ab12cd"
+	if got, want := thumbnailer.Path(hash), filepath.Join(thumbnailer.Dir, "ab", "ab12cd.jpg"); got != want {
+		t.Errorf("Path = %q, want %q", got, want)
+	}
+	if err := thumbnailer.store(hash, []byte("first")); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	// The same hash is the same image, so it is never written again
+	if err := thumbnailer.store(hash, []byte("second")); err != nil {
+		t.Fatalf("store again: %v", err)
+	}
+	data, err := ioutil.ReadFile(thumbnailer.Path(hash))
+	if err != nil || !bytes.Equal(data, []byte("first")) {
+		t.Errorf("stored %q, %v, want the first write", data, err)
+	}
+	files, _ := ioutil.ReadDir(filepath.Dir(thumbnailer.Path(hash)))
+	if len(files) != 1 {
+		t.Errorf("%d files next to the thumbnail, want no temporary files left", len(files))
+	}
+}
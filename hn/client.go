@@ -0,0 +1,82 @@
+package hn
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// Errors returned when Hacker News itself fails
+var (
+	ErrTimeout     = errors.New("hn: timed out")
+	ErrUnavailable = errors.New("hn: unavailable")
+	ErrUnexpected  = errors.New("hn: unexpected response")
+)
+
+// Timeout is the most time a request to Hacker News may take, including
+// reading the body.
+var Timeout = 20 * time.Second
+
+// RetryTimeout is the most time spent retrying an idempotent request.
+var RetryTimeout = 10 * time.Second
+
+// All Sessions share the connections to Hacker News but have their own cookies
+var transport = &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	Dial:                  (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).Dial,
+	TLSHandshakeTimeout:   5 * time.Second,
+	ResponseHeaderTimeout: 15 * time.Second,
+	MaxIdleConnsPerHost:   8,
+}
+
+func newRetryBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 250 * time.Millisecond
+	b.MaxElapsedTime = RetryTimeout
+	return b
+}
+
+// Converts errors from the HTTP client into ErrTimeout or ErrUnavailable, or
+// the error of the context of the request once the caller gave up on it
+func classify(req *http.Request, err error) error {
+	if ctxErr := req.Context().Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return ErrTimeout
+	}
+	return ErrUnavailable
+}
+
+// Converts unsuccessful status codes into errors
+func statusError(status int) error {
+	switch {
+	case status == http.StatusOK:
+		return nil
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrTooFast
+	case status == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case status == http.StatusServiceUnavailable || status == http.StatusBadGateway:
+		return ErrUnavailable
+	default:
+		return ErrUnexpected
+	}
+}
+
+// Only failures of Hacker News itself are worth retrying
+func retryable(err error) bool {
+	return err == ErrTimeout || err == ErrUnavailable
+}
+
+// Temporary returns true if an action failed because Hacker News is throttling
+// or unavailable, and trying it again later may succeed. Timeouts are not
+// temporary since the action may have gone through.
+func Temporary(err error) bool {
+	return err == ErrTooFast || err == ErrUnavailable
+}
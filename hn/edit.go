@@ -0,0 +1,102 @@
+package hn
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNotEditable is returned when the comment is not written by the user or
+// the edit window of Hacker News has closed.
+var ErrNotEditable = errors.New("hn: comment cannot be edited")
+
+// EditText returns the current text of the comment with the given id as
+// written in the edit form.
+func (session *Session) EditText(ctx context.Context, id int) (string, error) {
+	root, err := session.get(ctx, "edit?id="+strconv.Itoa(id))
+	if err != nil {
+		return "", err
+	}
+	if _, ok := parseForm(root, "xedit"); !ok {
+		return "", ErrNotEditable
+	}
+	textarea, ok := scrape.Find(root, func(n *html.Node) bool {
+		return n.DataAtom == atom.Textarea && scrape.Attr(n, "name") == "text"
+	})
+	if !ok {
+		return "", ErrUnexpected
+	}
+	// The text is kept as written, scrape.Text would collapse the paragraphs
+	var text string
+	for child := textarea.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			text += child.Data
+		}
+	}
+	return text, nil
+}
+
+// Edit replaces the text of the comment with the given id and returns the id
+// of the story the comment is on.
+func (session *Session) Edit(ctx context.Context, id int, text string) (int, error) {
+	if strings.TrimSpace(text) == "" {
+		return 0, ErrEmptyComment
+	}
+
+	root, err := session.get(ctx, "edit?id="+strconv.Itoa(id))
+	if err != nil {
+		return 0, err
+	}
+	values, ok := parseForm(root, "xedit")
+	if !ok || values.Get("id") != strconv.Itoa(id) {
+		return 0, ErrNotEditable
+	}
+	story, ok := storyOf(root)
+	if !ok {
+		return 0, ErrUnexpected
+	}
+	values.Set("text", text)
+	if _, err := session.post(ctx, "xedit", values); err != nil {
+		return 0, err
+	}
+	return story, nil
+}
+
+// Delete deletes the comment with the given id and returns the id of the story
+// the comment was on.
+func (session *Session) Delete(ctx context.Context, id int) (int, error) {
+	root, err := session.get(ctx, "delete-confirm?id="+strconv.Itoa(id)+"&goto="+url.QueryEscape("item?id="+strconv.Itoa(id)))
+	if err != nil {
+		return 0, err
+	}
+	values, ok := parseForm(root, "xdelete")
+	if !ok || values.Get("id") != strconv.Itoa(id) {
+		return 0, ErrNotEditable
+	}
+	story, ok := storyOf(root)
+	if !ok {
+		return 0, ErrUnexpected
+	}
+	values.Set("d", "Yes") // The confirm button
+	if _, err := session.post(ctx, "xdelete", values); err != nil {
+		return 0, err
+	}
+	return story, nil
+}
+
+// Returns the id of the story linked as 'on:' next to a comment
+func storyOf(root *html.Node) (int, bool) {
+	link, ok := scrape.Find(root, func(n *html.Node) bool {
+		return n.DataAtom == atom.A && n.Parent != nil && scrape.Attr(n.Parent, "class") == "onstory"
+	})
+	if !ok {
+		return 0, false
+	}
+	return linkID(link)
+}
@@ -0,0 +1,123 @@
+package hn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// The edit and delete pages of comment 9 on story 3, as written by alice
+const editPage = `<html><body><span class="onstory"> | on: <a href="item?id=3">A story</a></span>
+<form action="xedit" method="post"><input type="hidden" name="id" value="9"><input type="hidden" name="hmac" value="e9"><textarea name="text">First paragraph
+
+Second paragraph</textarea></form></body></html>`
+
+const deletePage = `<html><body><span class="onstory"> | on: <a href="item?id=3">A story</a></span>
+<form action="xdelete" method="post"><input type="hidden" name="id" value="9"><input type="hidden" name="hmac" value="d9"><input type="hidden" name="goto" value="item?id=9"></form></body></html>`
+
+// Serves the edit and delete pages of comment 9 and records the posted forms
+func serveEdit(t *testing.T, posted map[string]url.Values) *Session {
+	return serveHN(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/edit":
+			if r.URL.Query().Get("id") != "9" {
+				fmt.Fprint(w, `<html><body>You can't edit that.</body></html>`)
+				return
+			}
+			fmt.Fprint(w, editPage)
+		case "/delete-confirm":
+			if r.URL.Query().Get("id") != "9" {
+				fmt.Fprint(w, `<html><body>You can't delete that.</body></html>`)
+				return
+			}
+			fmt.Fprint(w, deletePage)
+		case "/xedit", "/xdelete":
+			r.ParseForm()
+			posted[r.URL.Path] = r.PostForm
+			http.Redirect(w, r, "/item?id=3", http.StatusFound)
+		case "/item":
+			fmt.Fprint(w, `<html><body></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func TestStoryOf(t *testing.T) {
+	tests := []struct {
+		page   string
+		want   int
+		wantOK bool
+	}{
+		{editPage, 3, true},
+		{`<span class="onstory"> | on: <a href="item?id=12&p=2">A story</a></span>`, 12, true},
+		// The parent link of a comment is not the story
+		{`<span class="navs"><a href="item?id=8">parent</a></span>`, 0, false},
+		{`<span class="onstory"><a href="item?id=x">A story</a></span>`, 0, false},
+	}
+	for _, test := range tests {
+		root, err := html.Parse(strings.NewReader(test.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := storyOf(root); got != test.want || ok != test.wantOK {
+			t.Errorf("storyOf(%q) = %d, %v, want %d, %v", test.page, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestEditText(t *testing.T) {
+	session := serveEdit(t, make(map[string]url.Values))
+	text, err := session.EditText(context.Background(), 9)
+	if err != nil || text != "First paragraph\n\nSecond paragraph" {
+		t.Errorf("EditText = %q, %v, want the text with its paragraphs", text, err)
+	}
+	if _, err := session.EditText(context.Background(), 10); err != ErrNotEditable {
+		t.Errorf("EditText of a comment of someone else = %v, want %v", err, ErrNotEditable)
+	}
+}
+
+func TestEditAndDelete(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    func(session *Session) (int, error)
+		path      string // Where the form is posted
+		wantStory int
+		wantErr   error
+		want      url.Values // The posted form
+	}{
+		{"edit", func(session *Session) (int, error) {
+			return session.Edit(context.Background(), 9, "New text")
+		}, "/xedit", 3, nil, url.Values{"id": {"9"}, "hmac": {"e9"}, "text": {"New text"}}},
+		{"edit empty", func(session *Session) (int, error) {
+			return session.Edit(context.Background(), 9, " ")
+		}, "/xedit", 0, ErrEmptyComment, nil},
+		{"edit not editable", func(session *Session) (int, error) {
+			return session.Edit(context.Background(), 10, "New text")
+		}, "/xedit", 0, ErrNotEditable, nil},
+		{"delete", func(session *Session) (int, error) {
+			return session.Delete(context.Background(), 9)
+		}, "/xdelete", 3, nil, url.Values{"id": {"9"}, "hmac": {"d9"}, "goto": {"item?id=9"}, "d": {"Yes"}}},
+		{"delete not editable", func(session *Session) (int, error) {
+			return session.Delete(context.Background(), 10)
+		}, "/xdelete", 0, ErrNotEditable, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			posted := make(map[string]url.Values)
+			session := serveEdit(t, posted)
+			story, err := test.action(session)
+			if story != test.wantStory || err != test.wantErr {
+				t.Errorf("got %d, %v, want %d, %v", story, err, test.wantStory, test.wantErr)
+			}
+			if got := posted[test.path]; got.Encode() != test.want.Encode() {
+				t.Errorf("posted %v to %s, want %v", got, test.path, test.want)
+			}
+		})
+	}
+}
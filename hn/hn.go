@@ -0,0 +1,287 @@
+package hn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cenkalti/backoff"
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// BaseURL is where Hacker News is, point it at a local stand-in server to
+// test the actions without touching the real site.
+var BaseURL = "https://news.ycombinator.com/"
+
+// Errors returned by the actions of a Session
+var (
+	ErrBadLogin     = errors.New("hn: bad login")
+	ErrNotFound     = errors.New("hn: item not found")
+	ErrCannotVote   = errors.New("hn: cannot vote on item")
+	ErrEmptyComment = errors.New("hn: empty comment")
+	ErrTooFast      = errors.New("hn: posting too fast")
+)
+
+// Session is a user logged in to Hacker News. Each Session has its own
+// cookie jar holding the user cookie.
+type Session struct {
+	Username string
+
+	client *http.Client
+	base   *url.URL
+}
+
+// Login logs the user in to Hacker News and returns its Session.
+func Login(ctx context.Context, username string, password string) (*Session, error) {
+	session, err := newSession(username)
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	values.Set("acct", username)
+	values.Set("pw", password)
+	values.Set("goto", "news")
+	if _, err := session.post(ctx, "login", values); err != nil {
+		return nil, err
+	}
+	if session.Cookie() == "" {
+		return nil, ErrBadLogin
+	}
+	return session, nil
+}
+
+// Resume returns the Session of a user already logged in with the given user cookie.
+func Resume(username string, cookie string) (*Session, error) {
+	session, err := newSession(username)
+	if err != nil {
+		return nil, err
+	}
+	session.client.Jar.SetCookies(session.base, []*http.Cookie{{Name: "user", Value: cookie}})
+	return session, nil
+}
+
+func newSession(username string) (*Session, error) {
+	base, err := url.Parse(BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	session := new(Session)
+	session.Username = username
+	session.base = base
+	session.client = &http.Client{Jar: jar, Transport: transport, Timeout: Timeout}
+	return session, nil
+}
+
+// Cookie returns the value of the user cookie of the Session, empty if not logged in.
+func (session *Session) Cookie() string {
+	for _, cookie := range session.client.Jar.Cookies(session.base) {
+		if cookie.Name == "user" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// Upvote upvotes the story or comment with the given id.
+func (session *Session) Upvote(ctx context.Context, id int) error {
+	root, err := session.get(ctx, "item?id="+strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+	if !hasItem(root, id) {
+		return ErrNotFound
+	}
+
+	// The vote link carries the auth token needed to vote and is missing if the user cannot vote
+	link, ok := scrape.Find(root, func(n *html.Node) bool {
+		return n.DataAtom == atom.A && scrape.Attr(n, "id") == "up_"+strconv.Itoa(id)
+	})
+	if !ok || scrape.Attr(link, "href") == "" {
+		return ErrCannotVote
+	}
+	_, err = session.act(ctx, scrape.Attr(link, "href"))
+	return err
+}
+
+// Comment writes a comment on the story with the given id.
+func (session *Session) Comment(ctx context.Context, id int, text string) error {
+	return session.comment(ctx, "item?id="+strconv.Itoa(id), id, text)
+}
+
+// Reply writes a reply to the comment with the given id.
+func (session *Session) Reply(ctx context.Context, id int, text string) error {
+	return session.comment(ctx, "reply?id="+strconv.Itoa(id), id, text)
+}
+
+// Fills in and submits the comment form found on the page at path
+func (session *Session) comment(ctx context.Context, path string, id int, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return ErrEmptyComment
+	}
+
+	root, err := session.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	values, ok := parseForm(root, "comment")
+	if !ok || values.Get("parent") != strconv.Itoa(id) {
+		return ErrNotFound
+	}
+	values.Set("text", text)
+	_, err = session.post(ctx, "comment", values)
+	return err
+}
+
+// Makes an idempotent GET request relative to BaseURL, retrying when Hacker
+// News is unavailable until ctx is done, and parses the response
+func (session *Session) get(ctx context.Context, path string) (*html.Node, error) {
+	var root *html.Node
+	var permanent error
+	operation := func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", session.resolve(path), nil)
+		if err != nil {
+			permanent = err
+			return nil
+		}
+		root, err = session.do(req)
+		if retryable(err) {
+			return err
+		}
+		permanent = err
+		return nil
+	}
+	if err := backoff.Retry(operation, newRetryBackOff()); err != nil {
+		return nil, err
+	}
+	return root, permanent
+}
+
+// Makes a GET request that performs an action, such as following a vote
+// link, which is never retried
+func (session *Session) act(ctx context.Context, path string) (*html.Node, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", session.resolve(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	return session.do(req)
+}
+
+// Makes a form POST request relative to BaseURL, which is never retried, and
+// parses the response
+func (session *Session) post(ctx context.Context, path string, values url.Values) (*html.Node, error) {
+	root, _, err := session.postURL(ctx, path, values)
+	return root, err
+}
+
+// Like post but also returns the URL of the response after redirects
+func (session *Session) postURL(ctx context.Context, path string, values url.Values) (*html.Node, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", session.resolve(path), strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return session.doURL(req)
+}
+
+func (session *Session) do(req *http.Request) (*html.Node, error) {
+	root, _, err := session.doURL(req)
+	return root, err
+}
+
+// Like do but also returns the URL of the response after redirects
+func (session *Session) doURL(req *http.Request) (*html.Node, *url.URL, error) {
+	resp, err := session.client.Do(req)
+	if err != nil {
+		return nil, nil, classify(req, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, classify(req, err)
+	}
+	if err := statusError(resp.StatusCode); err != nil {
+		return nil, nil, err
+	}
+
+	if err := textError(body); err != nil {
+		return nil, nil, err
+	}
+	root, err := html.Parse(bytes.NewReader(body))
+	return root, resp.Request.URL, err
+}
+
+// Hacker News answers some failures with a short page of plain text instead
+// of HTML, these are the exact messages
+var textErrors = map[string]error{
+	"Bad login.": ErrBadLogin,
+	"You're posting too fast. Please slow down. Thanks.": ErrTooFast,
+	"No such item.":            ErrNotFound,
+	"Unknown.":                 ErrNotFound,
+	"Unknown or expired link.": ErrNotFound,
+}
+
+// Longest body that is checked for a plain text error, pages are far longer
+const maxTextError = 1024
+
+// Returns the error of a plain text failure, nil for any other page. Only the
+// text before the first tag is compared so that an HTML page never matches,
+// whatever the comments on it say.
+func textError(body []byte) error {
+	if len(body) > maxTextError {
+		return nil
+	}
+	text := string(body)
+	if i := strings.Index(text, "<"); i >= 0 {
+		text = text[:i]
+	}
+	return textErrors[strings.TrimSpace(text)]
+}
+
+func (session *Session) resolve(path string) string {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return session.base.String()
+	}
+	return session.base.ResolveReference(ref).String()
+}
+
+// Returns the values of the hidden inputs of the form posting to action
+func parseForm(root *html.Node, action string) (url.Values, bool) {
+	form, ok := scrape.Find(root, func(n *html.Node) bool {
+		return n.DataAtom == atom.Form && scrape.Attr(n, "action") == action
+	})
+	if !ok {
+		return nil, false
+	}
+
+	values := url.Values{}
+	inputs := scrape.FindAll(form, func(n *html.Node) bool {
+		return n.DataAtom == atom.Input && scrape.Attr(n, "type") == "hidden"
+	})
+	for _, input := range inputs {
+		values.Set(scrape.Attr(input, "name"), scrape.Attr(input, "value"))
+	}
+	return values, true
+}
+
+// Returns true if the page is the item page of the item with the given id
+func hasItem(root *html.Node, id int) bool {
+	_, ok := scrape.Find(root, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && scrape.Attr(n, "id") == strconv.Itoa(id)
+	})
+	return ok
+}
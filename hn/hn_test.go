@@ -0,0 +1,246 @@
+package hn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextError(t *testing.T) {
+	tests := []struct {
+		body string
+		want error
+	}{
+		{"Bad login.", ErrBadLogin},
+		{"Bad login.<br><br><b>Login</b><form action=\"login\">", ErrBadLogin},
+		{"You're posting too fast. Please slow down. Thanks.\n", ErrTooFast},
+		{"No such item.", ErrNotFound},
+		{"Unknown.", ErrNotFound},
+		{"Unknown or expired link.", ErrNotFound},
+		{"", nil},
+		{"Unknown user.", nil},
+		// The comments on an item page may say anything
+		{"<html><body><span class=\"commtext\">You're posting too fast. Please slow down. Thanks.</span></body></html>", nil},
+		{"<html><body><span class=\"commtext\">Bad login.</span></body></html>", nil},
+	}
+	for _, test := range tests {
+		if got := textError([]byte(test.body)); got != test.want {
+			t.Errorf("textError(%q) = %v, want %v", test.body, got, test.want)
+		}
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ErrTooFast, true},
+		{ErrUnavailable, true},
+		{ErrTimeout, false},
+		{ErrNotFound, false},
+		{ErrBadLogin, false},
+		{ErrUnexpected, false},
+	}
+	for _, test := range tests {
+		if got := Temporary(test.err); got != test.want {
+			t.Errorf("Temporary(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+// A stand-in for Hacker News serving the pages and forms the actions use
+type fakeHN struct {
+	votes    []string // Query strings of the vote links followed
+	comments []url.Values
+}
+
+func (fake *fakeHN) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	loggedIn := false
+	if cookie, err := r.Cookie("user"); err == nil && cookie.Value == "alice&token" {
+		loggedIn = true
+	}
+	switch r.URL.Path {
+	case "/login":
+		r.ParseForm()
+		if r.PostForm.Get("acct") != "alice" || r.PostForm.Get("pw") != "secret" {
+			fmt.Fprint(w, `Bad login.<br><br><b>Login</b><form action="login" method="post"></form>`)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "user", Value: "alice&token", Path: "/"})
+		http.Redirect(w, r, "/news", http.StatusFound)
+	case "/news":
+		fmt.Fprint(w, `<html><body><a id="up_1" href="vote?id=1&how=up&auth=abc"></a><a id="up_2" class="nosee" href="vote?id=2&how=up&auth=abc"></a><a id="un_2" href="vote?id=2&how=un&auth=abc">unvote</a></body></html>`)
+	case "/item":
+		id := r.URL.Query().Get("id")
+		if id == "404" {
+			fmt.Fprint(w, "No such item.")
+			return
+		}
+		// The comments may contain the text of the errors without being one
+		fmt.Fprintf(w, `<html><body><table><tr class="athing" id="%s"><td><a id="up_%s" href="vote?id=%s&how=up&auth=abc&goto=item%%3Fid%%3D%s"></a></td></tr></table>
+<form action="comment" method="post"><input type="hidden" name="parent" value="%s"><input type="hidden" name="hmac" value="h%s"><textarea name="text"></textarea></form>
+<span class="commtext">You're posting too fast. Please slow down. Thanks.</span></body></html>`, id, id, id, id, id, id)
+	case "/reply":
+		id := r.URL.Query().Get("id")
+		fmt.Fprintf(w, `<html><body><form action="comment" method="post"><input type="hidden" name="parent" value="%s"><input type="hidden" name="goto" value="item?id=1#%s"><input type="hidden" name="hmac" value="r%s"><textarea name="text"></textarea></form></body></html>`, id, id, id)
+	case "/vote":
+		if !loggedIn {
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+		fake.votes = append(fake.votes, r.URL.RawQuery)
+		http.Redirect(w, r, "/news", http.StatusFound)
+	case "/comment":
+		r.ParseForm()
+		if !loggedIn {
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+		if r.PostForm.Get("text") == "too fast" {
+			fmt.Fprint(w, "You're posting too fast. Please slow down. Thanks.")
+			return
+		}
+		fake.comments = append(fake.comments, r.PostForm)
+		http.Redirect(w, r, "/news", http.StatusFound)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Points BaseURL at a new stand-in for the duration of the test
+func startFakeHN(t *testing.T) *fakeHN {
+	fake := new(fakeHN)
+	server := httptest.NewServer(fake)
+	base := BaseURL
+	BaseURL = server.URL + "/"
+	t.Cleanup(func() {
+		BaseURL = base
+		server.Close()
+	})
+	return fake
+}
+
+// Points BaseURL at a stand-in answering with handler for the duration of the
+// test and returns the Session of a user logged in to it
+func serveHN(t *testing.T, handler http.HandlerFunc) *Session {
+	server := httptest.NewServer(handler)
+	base := BaseURL
+	BaseURL = server.URL + "/"
+	t.Cleanup(func() {
+		BaseURL = base
+		server.Close()
+	})
+	session, err := Resume("alice", "alice&token")
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	return session
+}
+
+func login(t *testing.T) *Session {
+	session, err := Login(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return session
+}
+
+func TestLogin(t *testing.T) {
+	startFakeHN(t)
+	session := login(t)
+	if session.Cookie() != "alice&token" {
+		t.Errorf("Cookie() = %q, want the user cookie", session.Cookie())
+	}
+	if _, err := Login(context.Background(), "alice", "wrong"); err != ErrBadLogin {
+		t.Errorf("Login with a wrong password = %v, want %v", err, ErrBadLogin)
+	}
+
+	resumed, err := Resume("alice", session.Cookie())
+	if err != nil || resumed.Cookie() != session.Cookie() {
+		t.Errorf("Resume = %v, %v, want the same cookie", resumed, err)
+	}
+}
+
+func TestUpvote(t *testing.T) {
+	fake := startFakeHN(t)
+	session := login(t)
+	if err := session.Upvote(context.Background(), 7); err != nil {
+		t.Fatalf("Upvote: %v", err)
+	}
+	if len(fake.votes) != 1 || !strings.HasPrefix(fake.votes[0], "id=7&how=up&auth=abc") {
+		t.Errorf("votes = %q, want the vote link of item 7", fake.votes)
+	}
+	if err := session.Upvote(context.Background(), 404); err != ErrNotFound {
+		t.Errorf("Upvote of a missing item = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestComment(t *testing.T) {
+	fake := startFakeHN(t)
+	session := login(t)
+	if err := session.Comment(context.Background(), 7, "Nice"); err != nil {
+		t.Fatalf("Comment: %v", err)
+	}
+	if len(fake.comments) != 1 {
+		t.Fatalf("comments = %v, want one", fake.comments)
+	}
+	if got := fake.comments[0]; got.Get("parent") != "7" || got.Get("hmac") != "h7" || got.Get("text") != "Nice" {
+		t.Errorf("comment form = %v, want parent 7, hmac h7 and the text", got)
+	}
+	if err := session.Comment(context.Background(), 7, "too fast"); err != ErrTooFast {
+		t.Errorf("Comment while throttled = %v, want %v", err, ErrTooFast)
+	}
+	if err := session.Comment(context.Background(), 7, "  "); err != ErrEmptyComment {
+		t.Errorf("empty Comment = %v, want %v", err, ErrEmptyComment)
+	}
+}
+
+func TestReply(t *testing.T) {
+	fake := startFakeHN(t)
+	session := login(t)
+	if err := session.Reply(context.Background(), 9, "Agreed"); err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if len(fake.comments) != 1 {
+		t.Fatalf("comments = %v, want one", fake.comments)
+	}
+	if got := fake.comments[0]; got.Get("parent") != "9" || got.Get("hmac") != "r9" || got.Get("goto") != "item?id=1#9" {
+		t.Errorf("reply form = %v, want parent 9, hmac r9 and goto", got)
+	}
+}
+
+func TestVoteState(t *testing.T) {
+	startFakeHN(t)
+	session := login(t)
+	state, err := session.VoteState(context.Background(), "news")
+	if err != nil {
+		t.Fatalf("VoteState: %v", err)
+	}
+	if !reflect.DeepEqual(state.Items, []int{1, 2}) || !reflect.DeepEqual(state.Voted, []int{2}) || len(state.Downvotable) != 0 {
+		t.Errorf("VoteState = %+v, want items 1 and 2 with 2 voted", state)
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	fake := startFakeHN(t)
+	session := login(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := session.Upvote(ctx, 7); err != context.Canceled {
+		t.Errorf("Upvote once canceled = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Upvote once canceled took %v, want no retries", time.Since(start))
+	}
+	if len(fake.votes) != 0 {
+		t.Errorf("votes = %q, want none", fake.votes)
+	}
+}
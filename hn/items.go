@@ -0,0 +1,133 @@
+package hn
+
+import (
+	"context"
+	"errors"
+	"hnews/scraper"
+	"hnews/services"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrUnavailableAction is returned when the link of an action is missing from
+// the item, e.g. unhiding a story that is not hidden.
+var ErrUnavailableAction = errors.New("hn: action not available on item")
+
+// Favorite adds the story or comment with the given id to the favorites of the user.
+func (session *Session) Favorite(ctx context.Context, id int) error {
+	return session.itemAction(ctx, id, "fave", false)
+}
+
+// Unfavorite removes the story or comment with the given id from the favorites of the user.
+func (session *Session) Unfavorite(ctx context.Context, id int) error {
+	return session.itemAction(ctx, id, "fave", true)
+}
+
+// Hide hides the story with the given id from the lists of the user.
+func (session *Session) Hide(ctx context.Context, id int) error {
+	return session.itemAction(ctx, id, "hide", false)
+}
+
+// Unhide shows the hidden story with the given id in the lists of the user again.
+func (session *Session) Unhide(ctx context.Context, id int) error {
+	return session.itemAction(ctx, id, "hide", true)
+}
+
+// Flag flags the story or comment with the given id.
+func (session *Session) Flag(ctx context.Context, id int) error {
+	return session.itemAction(ctx, id, "flag", false)
+}
+
+// Unflag removes the flag of the user from the story or comment with the given id.
+func (session *Session) Unflag(ctx context.Context, id int) error {
+	return session.itemAction(ctx, id, "flag", true)
+}
+
+// Unvote removes the vote of the user from the story or comment with the given id.
+func (session *Session) Unvote(ctx context.Context, id int) error {
+	root, err := session.get(ctx, "item?id="+strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+	if !hasItem(root, id) {
+		return ErrNotFound
+	}
+	href, ok := findActionLink(root, id, func(action string, query url.Values) bool {
+		return action == "vote" && query.Get("how") == "un"
+	})
+	if !ok {
+		return ErrCannotVote
+	}
+	_, err = session.act(ctx, href)
+	return err
+}
+
+// Follows the link of the action on the item page, undo selects the un-link
+func (session *Session) itemAction(ctx context.Context, id int, action string, undo bool) error {
+	root, err := session.get(ctx, "item?id="+strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+	if !hasItem(root, id) {
+		return ErrNotFound
+	}
+	href, ok := findActionLink(root, id, func(path string, query url.Values) bool {
+		return path == action && (query.Get("un") == "t") == undo
+	})
+	if !ok {
+		return ErrUnavailableAction
+	}
+	_, err = session.act(ctx, href)
+	return err
+}
+
+// Returns the href of the first link of an action on the item with the given
+// id, the links carry the auth token needed to perform the action
+func findActionLink(root *html.Node, id int, match func(path string, query url.Values) bool) (string, bool) {
+	link, ok := scrape.Find(root, func(n *html.Node) bool {
+		if n.DataAtom != atom.A {
+			return false
+		}
+		u, err := url.Parse(scrape.Attr(n, "href"))
+		if err != nil || u.Query().Get("id") != strconv.Itoa(id) || u.Query().Get("auth") == "" {
+			return false
+		}
+		return match(strings.TrimPrefix(u.Path, "/"), u.Query())
+	})
+	if !ok {
+		return "", false
+	}
+	return scrape.Attr(link, "href"), true
+}
+
+// FavoriteNews returns a page of the stories the user has favorited.
+func (session *Session) FavoriteNews(ctx context.Context, page int) ([]services.News, error) {
+	return session.newsList(ctx, "favorites?id="+url.QueryEscape(session.Username)+"&p="+strconv.Itoa(page))
+}
+
+// FavoriteComments returns a page of the comments the user has favorited.
+func (session *Session) FavoriteComments(ctx context.Context, page int) ([]services.Comment, error) {
+	root, err := session.get(ctx, "favorites?id="+url.QueryEscape(session.Username)+"&comments=t&p="+strconv.Itoa(page))
+	if err != nil {
+		return nil, err
+	}
+	return scraper.ParseComments(root, 0), nil
+}
+
+// HiddenNews returns a page of the stories the user has hidden.
+func (session *Session) HiddenNews(ctx context.Context, page int) ([]services.News, error) {
+	return session.newsList(ctx, "hidden?id="+url.QueryEscape(session.Username)+"&p="+strconv.Itoa(page))
+}
+
+func (session *Session) newsList(ctx context.Context, path string) ([]services.News, error) {
+	root, err := session.get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return scraper.ParseNews(root), nil
+}
@@ -0,0 +1,67 @@
+package hn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// The item page of story 5 as seen by a user who has hidden and voted on it.
+// The first flag link lacks the auth token and the fave link of comment 6
+// belongs to another item.
+const itemPage = `<html><body><table><tr class="athing" id="5"><td>
+<a href="flag?id=5">flag</a> | <a href="fave?id=6&auth=a">favorite</a> |
+<a href="vote?id=5&how=un&auth=a">unvote</a> | <a href="hide?id=5&un=t&auth=a&goto=news">un-hide</a> |
+<a href="flag?id=5&auth=a">flag</a> | <a href="fave?id=5&auth=a">favorite</a>
+</td></tr></table></body></html>`
+
+func TestItemActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  func(*Session, context.Context, int) error
+		id      int
+		want    string // The action link followed
+		wantErr error
+	}{
+		{"favorite", (*Session).Favorite, 5, "/fave?id=5&auth=a", nil},
+		{"unfavorite", (*Session).Unfavorite, 5, "", ErrUnavailableAction},
+		{"hide", (*Session).Hide, 5, "", ErrUnavailableAction},
+		{"unhide", (*Session).Unhide, 5, "/hide?id=5&un=t&auth=a&goto=news", nil},
+		{"flag", (*Session).Flag, 5, "/flag?id=5&auth=a", nil},
+		{"unflag", (*Session).Unflag, 5, "", ErrUnavailableAction},
+		{"unvote", (*Session).Unvote, 5, "/vote?id=5&how=un&auth=a", nil},
+		{"unvote without a vote", (*Session).Unvote, 8, "", ErrCannotVote},
+		{"favorite a missing item", (*Session).Favorite, 404, "", ErrNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var followed string
+			session := serveHN(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/item":
+					switch r.URL.Query().Get("id") {
+					case "5":
+						fmt.Fprint(w, itemPage)
+					case "8":
+						fmt.Fprint(w, `<html><body><table><tr class="athing" id="8"></tr></table></body></html>`)
+					default:
+						fmt.Fprint(w, "No such item.")
+					}
+				case "/fave", "/hide", "/flag", "/vote":
+					followed = r.URL.Path + "?" + r.URL.RawQuery
+					http.Redirect(w, r, "/item?id=5", http.StatusFound)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			if err := test.action(session, context.Background(), test.id); err != test.wantErr {
+				t.Errorf("got %v, want %v", err, test.wantErr)
+			}
+			if followed != test.want {
+				t.Errorf("followed %q, want %q", followed, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package hn
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Errors returned when submitting a story
+var (
+	ErrDuplicate = errors.New("hn: url already submitted")
+	ErrRejected  = errors.New("hn: submission rejected")
+)
+
+// Submit submits a story with a title and either a url or a text and returns
+// the id of the new item. If the url has already been submitted it returns
+// the id of the existing item together with ErrDuplicate.
+func (session *Session) Submit(ctx context.Context, title string, link string, text string) (int, error) {
+	root, err := session.get(ctx, "submit")
+	if err != nil {
+		return 0, err
+	}
+	// The fnid token of the form is required to submit
+	values, ok := parseForm(root, "r")
+	if !ok || values.Get("fnid") == "" {
+		return 0, ErrUnexpected
+	}
+	values.Set("title", title)
+	values.Set("url", link)
+	values.Set("text", text)
+
+	root, location, err := session.postURL(ctx, "r", values)
+	if err != nil {
+		return 0, err
+	}
+
+	// Duplicates are redirected to the existing item and new stories to newest
+	switch strings.TrimPrefix(location.Path, "/") {
+	case "item":
+		id, err := strconv.Atoi(location.Query().Get("id"))
+		if err != nil {
+			return 0, ErrUnexpected
+		}
+		return id, ErrDuplicate
+	case "newest":
+		return session.submittedID(ctx, title)
+	default:
+		// Hacker News shows the form again with a message when it rejects a submission
+		return 0, ErrRejected
+	}
+}
+
+// Returns the id of the latest story the user submitted with the given title
+func (session *Session) submittedID(ctx context.Context, title string) (int, error) {
+	root, err := session.get(ctx, "submitted?id="+url.QueryEscape(session.Username))
+	if err != nil {
+		return 0, err
+	}
+	stories := scrape.FindAll(root, func(n *html.Node) bool {
+		return n.DataAtom == atom.Tr && strings.Contains(scrape.Attr(n, "class"), "athing")
+	})
+	for _, story := range stories {
+		if !strings.Contains(scrape.Text(story), title) {
+			continue
+		}
+		if id, err := strconv.Atoi(scrape.Attr(story, "id")); err == nil {
+			return id, nil
+		}
+	}
+	return 0, ErrUnexpected
+}
@@ -0,0 +1,72 @@
+package hn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+const submitForm = `<html><body><form action="r" method="post"><input type="hidden" name="fnid" value="f1"><input type="hidden" name="fnop" value="submit-page"><input type="text" name="title"></form></body></html>`
+
+const submittedPage = `<html><body><table>
+<tr class="athing" id="41"><td class="title"><a href="https://example.com/old">An older story</a></td></tr>
+<tr class="athing" id="42"><td class="title"><a href="https://example.com/new">Show HN: A new story</a></td></tr>
+</table></body></html>`
+
+func TestSubmit(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    string // The page of the submit form
+		respond func(w http.ResponseWriter, r *http.Request)
+		wantID  int
+		wantErr error
+	}{
+		{"new story", submitForm, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/newest", http.StatusFound)
+		}, 42, nil},
+		{"duplicate", submitForm, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/item?id=7", http.StatusFound)
+		}, 7, ErrDuplicate},
+		{"rejected", submitForm, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `<html><body>That's not a valid URL.`+submitForm+`</body></html>`)
+		}, 0, ErrRejected},
+		{"too fast", submitForm, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "You're posting too fast. Please slow down. Thanks.")
+		}, 0, ErrTooFast},
+		{"no form", `<html><body>Please log in.</body></html>`, nil, 0, ErrUnexpected},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var posted url.Values
+			session := serveHN(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/submit":
+					fmt.Fprint(w, test.form)
+				case "/r":
+					r.ParseForm()
+					posted = r.PostForm
+					test.respond(w, r)
+				case "/newest", "/item":
+					fmt.Fprint(w, `<html><body></body></html>`)
+				case "/submitted":
+					fmt.Fprint(w, submittedPage)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			id, err := session.Submit(context.Background(), "Show HN: A new story", "https://example.com/new", "")
+			if id != test.wantID || err != test.wantErr {
+				t.Errorf("Submit = %d, %v, want %d, %v", id, err, test.wantID, test.wantErr)
+			}
+			if test.respond == nil {
+				return
+			}
+			if posted.Get("fnid") != "f1" || posted.Get("fnop") != "submit-page" || posted.Get("title") != "Show HN: A new story" || posted.Get("url") != "https://example.com/new" {
+				t.Errorf("posted form = %v, want the hidden inputs, title and url", posted)
+			}
+		})
+	}
+}
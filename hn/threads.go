@@ -0,0 +1,108 @@
+package hn
+
+import (
+	"context"
+	"hnews/scraper"
+	"hnews/services"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Replies returns the direct replies to the comments of the user found on
+// the first page of their threads.
+func (session *Session) Replies(ctx context.Context) ([]services.Notification, error) {
+	root, err := session.get(ctx, "threads?id="+url.QueryEscape(session.Username))
+	if err != nil {
+		return nil, err
+	}
+	comments := scraper.ParseComments(root, 0)
+	stories := parseStories(root)
+
+	var replies []services.Notification
+	var story int32
+	parents := make(map[int32]services.Comment) // The latest comment seen at each offset
+	for _, comment := range comments {
+		if comment.Offset == 0 {
+			story = stories[comment.ID]
+		}
+		parents[comment.Offset] = comment
+		if comment.Offset == 0 || comment.Author == "" || comment.Author == session.Username {
+			continue
+		}
+		parent, ok := parents[comment.Offset-1]
+		if !ok || parent.Author != session.Username {
+			continue
+		}
+		replies = append(replies, services.Notification{ID: comment.ID, Parent: parent.ID, Story: story,
+			Author: comment.Author, Text: comment.Text, Time: comment.Time})
+	}
+	return replies, nil
+}
+
+// StoryReplies returns the top level comments on the stories the user
+// submitted after since.
+func (session *Session) StoryReplies(ctx context.Context, since time.Time) ([]services.Notification, error) {
+	stories, err := session.newsList(ctx, "submitted?id="+url.QueryEscape(session.Username))
+	if err != nil {
+		return nil, err
+	}
+
+	var replies []services.Notification
+	for _, story := range stories {
+		if story.ID == 0 || story.Comments == 0 || story.Time.Before(since) {
+			continue
+		}
+		root, err := session.get(ctx, "item?id="+strconv.Itoa(int(story.ID)))
+		if err != nil {
+			return replies, err
+		}
+		for _, comment := range scraper.ParseComments(root, story.ID) {
+			if comment.Offset != 0 || comment.Author == "" || comment.Author == session.Username {
+				continue
+			}
+			replies = append(replies, services.Notification{ID: comment.ID, Parent: story.ID, Story: story.ID,
+				Author: comment.Author, Text: comment.Text, Time: comment.Time})
+		}
+	}
+	return replies, nil
+}
+
+// Returns the id of the story each comment is on, only the comments with an
+// 'on:' link are included
+func parseStories(root *html.Node) map[int32]int32 {
+	stories := make(map[int32]int32)
+	heads := scrape.FindAll(root, func(n *html.Node) bool {
+		return n.DataAtom == atom.Span && scrape.Attr(n, "class") == "comhead"
+	})
+	for _, head := range heads {
+		age, ok := scrape.Find(head, func(n *html.Node) bool {
+			return n.DataAtom == atom.A && n.Parent != nil && scrape.Attr(n.Parent, "class") == "age"
+		})
+		if !ok {
+			continue
+		}
+		id, ok := linkID(age)
+		if !ok {
+			continue
+		}
+		if story, ok := storyOf(head); ok {
+			stories[int32(id)] = int32(story)
+		}
+	}
+	return stories
+}
+
+// Returns the id in the query of a link to an item
+func linkID(link *html.Node) (int, bool) {
+	u, err := url.Parse(scrape.Attr(link, "href"))
+	if err != nil {
+		return 0, false
+	}
+	id, err := strconv.Atoi(u.Query().Get("id"))
+	return id, err == nil
+}
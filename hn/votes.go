@@ -0,0 +1,67 @@
+package hn
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// VoteState is what the user may do with the items on a page of Hacker News.
+type VoteState struct {
+	Items       []int // Every item with a vote arrow or unvote link
+	Voted       []int // Items the user has voted on
+	Downvotable []int // Items the user may downvote
+}
+
+// VoteState scrapes the page at path, relative to BaseURL, as the user sees
+// it. Hacker News hides the arrows of the items the user has voted on and
+// only shows the down arrows to users with enough karma.
+func (session *Session) VoteState(ctx context.Context, path string) (VoteState, error) {
+	var state VoteState
+	root, err := session.get(ctx, path)
+	if err != nil {
+		return state, err
+	}
+
+	seen := make(map[int]bool)
+	voted := make(map[int]bool)
+	links := scrape.FindAll(root, func(n *html.Node) bool {
+		return n.DataAtom == atom.A && strings.Contains(scrape.Attr(n, "id"), "_")
+	})
+	for _, link := range links {
+		parts := strings.SplitN(scrape.Attr(link, "id"), "_", 2)
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		hidden := strings.Contains(scrape.Attr(link, "class"), "nosee")
+		switch parts[0] {
+		case "up":
+			if hidden {
+				voted[id] = true
+			}
+		case "un":
+			voted[id] = true
+		case "down":
+			if !hidden {
+				state.Downvotable = append(state.Downvotable, id)
+			}
+		default:
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			state.Items = append(state.Items, id)
+		}
+	}
+	for _, id := range state.Items {
+		if voted[id] {
+			state.Voted = append(state.Voted, id)
+		}
+	}
+	return state, nil
+}
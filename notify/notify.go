@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"hnews/hn"
+	"hnews/services"
+	"hnews/session"
+	"log"
+	"time"
+)
+
+// Notifier checks the threads of every user with an active Session for new
+// replies in the background and stores them as Notifications.
+type Notifier struct {
+	Interval    time.Duration // Time between the checks of a user
+	MaxStoryAge time.Duration // Only the stories submitted within this are checked for replies
+
+	sessions *session.Store
+}
+
+// NewNotifier creates a Notifier checking the users of the Sessions in store.
+func NewNotifier(store *session.Store) *Notifier {
+	notifier := new(Notifier)
+	notifier.Interval = 10 * time.Minute
+	notifier.MaxStoryAge = 48 * time.Hour
+	notifier.sessions = store
+	return notifier
+}
+
+// Start checks every user each Interval until ctx is done, run as a goroutine.
+func (notifier *Notifier) Start(ctx context.Context, debug bool) {
+	for {
+		start := time.Now()
+		for _, s := range notifier.sessions.Active() {
+			if ctx.Err() != nil {
+				return
+			}
+			added, err := notifier.check(ctx, s)
+			if err != nil {
+				if debug {
+					log.Println("Notify:", s.Username, err)
+				}
+				continue
+			}
+			if debug && added > 0 {
+				log.Println(added, "new notifications for", s.Username)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(notifier.Interval - time.Since(start)):
+		}
+	}
+}
+
+// Checks the replies to the comments and stories of the user of the Session
+// and returns the number of new ones
+func (notifier *Notifier) check(ctx context.Context, s *session.Session) (int, error) {
+	hnSession, err := hn.Resume(s.Username, s.Cookie)
+	if err != nil {
+		return 0, err
+	}
+	replies, err := hnSession.Replies(ctx)
+	if err != nil {
+		return 0, err
+	}
+	storyReplies, err := hnSession.StoryReplies(ctx, time.Now().Add(-notifier.MaxStoryAge))
+	if err != nil {
+		return 0, err
+	}
+	return services.SaveNotifications(s.Username, append(replies, storyReplies...)), nil
+}
@@ -0,0 +1,155 @@
+package outbox
+
+import (
+	"context"
+	"hnews/hn"
+	"hnews/services"
+	"hnews/session"
+	"log"
+	"time"
+)
+
+// The kinds of OutboxActions
+const (
+	Upvote  = "upvote"
+	Comment = "comment"
+	Reply   = "reply"
+	Submit  = "submit"
+)
+
+// Worker delivers the queued OutboxActions to Hacker News in the background,
+// backing off while Hacker News is throttling or unavailable.
+type Worker struct {
+	Interval    time.Duration // Time between looking for due actions
+	MaxAttempts int           // Actions are failed after this many attempts
+	MinBackoff  time.Duration // Wait after the first failed attempt, doubled for every attempt
+	MaxBackoff  time.Duration // Longest wait between two attempts
+	KeepFor     time.Duration // Sent and failed actions are deleted after this
+
+	// Code returns the error code stored for a failed attempt
+	Code func(err error) string
+
+	sessions *session.Store
+}
+
+// NewWorker creates a Worker acting with the Sessions in store.
+func NewWorker(store *session.Store) *Worker {
+	worker := new(Worker)
+	worker.Interval = 15 * time.Second
+	worker.MaxAttempts = 10
+	worker.MinBackoff = time.Minute
+	worker.MaxBackoff = time.Hour
+	worker.KeepFor = 7 * 24 * time.Hour
+	worker.Code = func(err error) string { return err.Error() }
+	worker.sessions = store
+	return worker
+}
+
+// Start delivers the due actions each Interval until ctx is done, run as a
+// goroutine. The action being delivered when ctx is done is saved first.
+func (worker *Worker) Start(ctx context.Context, debug bool) {
+	for {
+		services.PurgeOutbox(worker.KeepFor)
+		actions := services.DueActions(time.Now())
+		if len(actions) > 0 {
+			worker.deliver(ctx, actions, debug)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(worker.Interval):
+		}
+	}
+}
+
+// Delivers the actions in order, once Hacker News throttles a user the rest
+// of the actions of the user wait until the next round
+func (worker *Worker) deliver(ctx context.Context, actions []services.OutboxAction, debug bool) {
+	sessions := make(map[string]*session.Session)
+	for _, s := range worker.sessions.Active() {
+		sessions[s.Username] = s
+	}
+
+	throttled := make(map[string]bool)
+	for _, action := range actions {
+		if ctx.Err() != nil {
+			return // The rest are delivered after a restart
+		}
+		if throttled[action.Username] {
+			continue
+		}
+		// The user may have canceled the action since the round started
+		if !services.ActionPending(action.ID) {
+			continue
+		}
+		action.Attempts++
+
+		s, ok := sessions[action.Username]
+		if !ok {
+			// The user logged out, the action can never be delivered
+			action.State = services.OutboxFailed
+			action.Error = "not_logged_in"
+			services.SaveAction(action)
+			continue
+		}
+		result, err := worker.perform(ctx, s, action)
+		if err != nil && ctx.Err() != nil {
+			// Cut off by the shutdown, like after a timeout the action may
+			// have gone through so it is not tried again
+			err = hn.ErrTimeout
+		}
+		switch {
+		case err == nil:
+			action.State = services.OutboxSent
+			action.Error = ""
+			action.Result = result
+		case hn.Temporary(err) && action.Attempts < worker.MaxAttempts:
+			throttled[action.Username] = true
+			action.Error = worker.Code(err)
+			action.NextAttempt = time.Now().Add(worker.Backoff(action.Attempts))
+		default:
+			action.State = services.OutboxFailed
+			action.Error = worker.Code(err)
+			action.Result = result
+		}
+		if debug && err != nil {
+			log.Println("Outbox:", action.Username, action.Kind, err)
+		}
+		// Canceled while it was being delivered, the cancel wins
+		if err := services.SaveAction(action); err == services.ErrNoAction && debug {
+			log.Println("Outbox:", action.Username, action.Kind, "canceled during delivery")
+		}
+	}
+}
+
+// Performs the action on Hacker News, returns the id of the story when submitting
+func (worker *Worker) perform(ctx context.Context, s *session.Session, action services.OutboxAction) (int, error) {
+	hnSession, err := hn.Resume(s.Username, s.Cookie)
+	if err != nil {
+		return 0, err
+	}
+	switch action.Kind {
+	case Upvote:
+		return 0, hnSession.Upvote(ctx, action.Item)
+	case Comment:
+		return 0, hnSession.Comment(ctx, action.Item, action.Text)
+	case Reply:
+		return 0, hnSession.Reply(ctx, action.Item, action.Text)
+	case Submit:
+		return hnSession.Submit(ctx, action.Title, action.URL, action.Text)
+	}
+	return 0, hn.ErrUnexpected
+}
+
+// Backoff returns the wait before the next attempt after the given number of
+// attempts.
+func (worker *Worker) Backoff(attempts int) time.Duration {
+	wait := worker.MinBackoff
+	for i := 1; i < attempts && wait < worker.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > worker.MaxBackoff {
+		wait = worker.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,211 @@
+package ranking
+
+import (
+	"hnews/services"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Params tunes how the Engine scores News.
+type Params struct {
+	Window         time.Duration // Only Samples newer than this are used for velocities
+	Gravity        float64       // Exponent with which a score decays with age
+	AgeOffset      float64       // Hours added to the age of a News before decaying
+	VelocityWeight float64       // Hours of the current velocity added to the points of a News
+	CommentWeight  float64       // Points a comment per hour is worth in the velocity
+	RisingMaxAge   time.Duration // News older than this are never rising
+	RisingMaxRank  int32         // News ranked this high on the front page are never rising
+}
+
+// DefaultParams are the Params used unless tuned otherwise.
+var DefaultParams = Params{
+	Window:         2 * time.Hour,
+	Gravity:        1.8,
+	AgeOffset:      2,
+	VelocityWeight: 2,
+	CommentWeight:  0.5,
+	RisingMaxAge:   6 * time.Hour,
+	RisingMaxRank:  30,
+}
+
+// Velocities shorter than this are too noisy to be measured.
+const minSpan = 10 * time.Minute
+
+// Score is a News together with the velocities it was scored by.
+type Score struct {
+	services.News
+	Score               float64 `json:"score"`
+	PointsPerHour       float64 `json:"points_per_hour"`
+	CommentsPerHour     float64 `json:"comments_per_hour"`
+	CommentAcceleration float64 `json:"comment_acceleration"` // Change in comments per hour, per hour
+}
+
+// Engine ranks News by the velocities in their History.
+type Engine struct {
+	Params Params
+
+	mutex    sync.RWMutex
+	trending []Score
+	rising   []Score
+	computed time.Time
+}
+
+// NewEngine creates an Engine scoring with the given Params.
+func NewEngine(params Params) *Engine {
+	engine := new(Engine)
+	engine.Params = params
+	return engine
+}
+
+// Recompute scores all the News sampled within the window, call after every scrape cycle.
+func (engine *Engine) Recompute() {
+	now := time.Now()
+	params := engine.Params
+	histories := services.ReadRecentHistory(now.Add(-params.Window))
+
+	var trending []Score
+	var rising []Score
+	for _, history := range histories {
+		if len(history.Samples) == 0 {
+			continue
+		}
+		score := scoreHistory(params, history, now)
+		trending = append(trending, score)
+		if isRising(params, history, now) {
+			rising = append(rising, score)
+		}
+	}
+
+	sort.Sort(byScore(trending))
+	sort.Sort(byVelocity(rising))
+	for i := range trending {
+		trending[i].Rank = int32(i + 1)
+	}
+	for i := range rising {
+		rising[i].Rank = int32(i + 1)
+	}
+
+	engine.mutex.Lock()
+	engine.trending = trending
+	engine.rising = rising
+	engine.computed = now
+	engine.mutex.Unlock()
+}
+
+// Trending returns the News ranked from index from to index to by their
+// gravity-decayed score.
+func (engine *Engine) Trending(from int, to int) []Score {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	return slice(engine.trending, from, to)
+}
+
+// Rising returns the young News off the front page ranked from index from to
+// index to by their velocity.
+func (engine *Engine) Rising(from int, to int) []Score {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	return slice(engine.rising, from, to)
+}
+
+// Totals returns the number of trending and rising News and when they were ranked.
+func (engine *Engine) Totals() (trending int, rising int, computed time.Time) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	return len(engine.trending), len(engine.rising), engine.computed
+}
+
+// Ranks are 1-based and inclusive like the lists
+func slice(scores []Score, from int, to int) []Score {
+	if from < 1 {
+		from = 1
+	}
+	if to > len(scores) {
+		to = len(scores)
+	}
+	if from > to {
+		return []Score{}
+	}
+	result := make([]Score, to-from+1)
+	copy(result, scores[from-1:to])
+	return result
+}
+
+func scoreHistory(params Params, history services.History, now time.Time) Score {
+	samples := history.Samples
+	first := samples[0]
+	last := samples[len(samples)-1]
+	news := history.News
+	news.Points = last.Points
+	news.Comments = last.Comments
+
+	score := Score{News: news}
+	age := now.Sub(news.Time)
+	if news.Time.IsZero() || age <= 0 {
+		age = now.Sub(first.Time)
+	}
+
+	span := last.Time.Sub(first.Time)
+	if span >= minSpan {
+		hours := span.Hours()
+		score.PointsPerHour = float64(last.Points-first.Points) / hours
+		score.CommentsPerHour = float64(last.Comments-first.Comments) / hours
+
+		// Compare the comment rate of the first and second half of the window
+		middle := samples[0]
+		for _, sample := range samples {
+			if sample.Time.Sub(first.Time) > span/2 {
+				break
+			}
+			middle = sample
+		}
+		firstHalf := middle.Time.Sub(first.Time).Hours()
+		secondHalf := last.Time.Sub(middle.Time).Hours()
+		if firstHalf > 0 && secondHalf > 0 {
+			before := float64(middle.Comments-first.Comments) / firstHalf
+			after := float64(last.Comments-middle.Comments) / secondHalf
+			score.CommentAcceleration = (after - before) / (span.Hours() / 2)
+		}
+	} else if age > 0 {
+		// Not sampled long enough, assume it has been climbing steadily since posted
+		score.PointsPerHour = float64(news.Points) / math.Max(age.Hours(), minSpan.Hours())
+		score.CommentsPerHour = float64(news.Comments) / math.Max(age.Hours(), minSpan.Hours())
+	}
+
+	velocity := score.PointsPerHour + params.CommentWeight*score.CommentsPerHour
+	points := math.Max(float64(news.Points-1), 0) + params.VelocityWeight*velocity
+	score.Score = points / math.Pow(age.Hours()+params.AgeOffset, params.Gravity)
+	return score
+}
+
+// Rising News are young and not near the top of the front page
+func isRising(params Params, history services.History, now time.Time) bool {
+	if !history.News.Time.IsZero() && now.Sub(history.News.Time) > params.RisingMaxAge {
+		return false
+	}
+	for i := len(history.Samples) - 1; i >= 0; i-- {
+		sample := history.Samples[i]
+		if sample.List == "top" {
+			return sample.Rank > params.RisingMaxRank
+		}
+	}
+	return true
+}
+
+// Sorts Scores by score, highest first
+type byScore []Score
+
+func (scores byScore) Len() int           { return len(scores) }
+func (scores byScore) Swap(i, j int)      { scores[i], scores[j] = scores[j], scores[i] }
+func (scores byScore) Less(i, j int) bool { return scores[i].Score > scores[j].Score }
+
+// Sorts Scores by velocity and comment acceleration, highest first
+type byVelocity []Score
+
+func (scores byVelocity) Len() int      { return len(scores) }
+func (scores byVelocity) Swap(i, j int) { scores[i], scores[j] = scores[j], scores[i] }
+func (scores byVelocity) Less(i, j int) bool {
+	return scores[i].PointsPerHour+scores[i].CommentAcceleration > scores[j].PointsPerHour+scores[j].CommentAcceleration
+}
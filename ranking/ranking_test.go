@@ -0,0 +1,88 @@
+package ranking
+
+import (
+	"hnews/services"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScoreHistory(t *testing.T) {
+	now := time.Now()
+	sample := func(ago time.Duration, points int32, comments int32) services.Sample {
+		return services.Sample{Time: now.Add(-ago), Points: points, Comments: comments}
+	}
+	tests := []struct {
+		name                           string
+		posted                         time.Duration
+		samples                        []services.Sample
+		pointsPerHour, commentsPerHour float64
+	}{
+		{"sampled for an hour", 3 * time.Hour, []services.Sample{sample(time.Hour, 10, 0), sample(0, 40, 6)}, 30, 6},
+		{"sampled too briefly", 2 * time.Hour, []services.Sample{sample(time.Minute, 10, 2), sample(0, 20, 4)}, 10, 2},
+		{"flat", 5 * time.Hour, []services.Sample{sample(2*time.Hour, 50, 10), sample(0, 50, 10)}, 0, 0},
+	}
+	for _, test := range tests {
+		history := services.History{News: services.News{ID: 1, Time: now.Add(-test.posted)}, Samples: test.samples}
+		score := scoreHistory(DefaultParams, history, now)
+		if math.Abs(score.PointsPerHour-test.pointsPerHour) > 0.01 || math.Abs(score.CommentsPerHour-test.commentsPerHour) > 0.01 {
+			t.Errorf("%s: velocities = %.2f, %.2f, want %.2f, %.2f", test.name,
+				score.PointsPerHour, score.CommentsPerHour, test.pointsPerHour, test.commentsPerHour)
+		}
+		if last := test.samples[len(test.samples)-1]; score.Points != last.Points {
+			t.Errorf("%s: points = %d, want the latest %d", test.name, score.Points, last.Points)
+		}
+	}
+}
+
+func TestScoreDecaysWithAge(t *testing.T) {
+	now := time.Now()
+	score := func(age time.Duration) float64 {
+		history := services.History{
+			News:    services.News{ID: 1, Time: now.Add(-age)},
+			Samples: []services.Sample{{Time: now.Add(-time.Hour), Points: 100}, {Time: now, Points: 100}},
+		}
+		return scoreHistory(DefaultParams, history, now).Score
+	}
+	if young, old := score(2*time.Hour), score(20*time.Hour); young <= old {
+		t.Errorf("score of a young news %v <= score of an old one %v", young, old)
+	}
+}
+
+func TestIsRising(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		posted  time.Duration
+		samples []services.Sample
+		want    bool
+	}{
+		{"young off the front page", time.Hour, []services.Sample{{List: "top", Rank: 45}}, true},
+		{"young near the top", time.Hour, []services.Sample{{List: "top", Rank: 45}, {List: "top", Rank: 3}}, false},
+		{"young on newest only", time.Hour, []services.Sample{{List: "newest", Rank: 1}}, true},
+		{"old", 10 * time.Hour, []services.Sample{{List: "top", Rank: 45}}, false},
+	}
+	for _, test := range tests {
+		history := services.History{News: services.News{Time: now.Add(-test.posted)}, Samples: test.samples}
+		if got := isRising(DefaultParams, history, now); got != test.want {
+			t.Errorf("%s: isRising = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	scores := []Score{{Score: 3}, {Score: 2}, {Score: 1}}
+	tests := []struct {
+		from, to int
+		want     int
+	}{
+		{1, 3, 3},
+		{2, 10, 2},
+		{4, 5, 0},
+	}
+	for _, test := range tests {
+		if got := slice(scores, test.from, test.to); len(got) != test.want {
+			t.Errorf("slice(%d, %d) has %d scores, want %d", test.from, test.to, len(got), test.want)
+		}
+	}
+}
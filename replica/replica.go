@@ -0,0 +1,282 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"hnews/services"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// The databases written by the scraper process are published as read-only
+// copies in generations, one directory per publish named after the time in
+// unix nanoseconds. The file currentFile holds the name of the latest one.
+const currentFile = "CURRENT"
+
+// The thumbnails are content-addressed so they are published once, in this
+// directory next to the generations, instead of with every generation
+const thumbnailsDir = "thumbnails"
+
+// ErrNotPublished is returned when nothing has been published yet
+var ErrNotPublished = errors.New("replica: nothing published yet")
+
+// Publisher publishes consistent read-only copies of the databases of the
+// scrapers for the API processes to serve from, see Follower.
+type Publisher struct {
+	Dir          string        // Directory the generations are published in
+	Interval     time.Duration // Time between each publish
+	Keep         int           // Number of generations kept
+	ThumbnailDir string        // Directory the thumbnails are published from, none if empty
+
+	dbs       []*services.DB
+	published map[string]bool // Thumbnails already published, by path relative to ThumbnailDir
+}
+
+// NewPublisher creates a Publisher of the global databases of the scrapers and
+// the databases of the lists.
+func NewPublisher(dir string, stores []*services.DatabaseService) *Publisher {
+	publisher := new(Publisher)
+	publisher.Dir = dir
+	publisher.Interval = time.Minute
+	publisher.Keep = 3
+	publisher.dbs = databases(stores)
+	publisher.published = make(map[string]bool)
+	return publisher
+}
+
+// Start publishes at the Interval until ctx is done, run as a goroutine.
+func (publisher *Publisher) Start(ctx context.Context, debug bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(publisher.Interval):
+		}
+		generation, err := publisher.Publish()
+		if err != nil {
+			log.Println("Publish:", err)
+			continue
+		}
+		if debug {
+			log.Println("Published", generation)
+		}
+	}
+}
+
+// Publish copies every database in one read transaction each into a new
+// generation and makes it the current one. The thumbnails generated since the
+// last publish are published first so that the generation never refers to a
+// thumbnail that is missing.
+func (publisher *Publisher) Publish() (string, error) {
+	if err := publisher.publishThumbnails(); err != nil {
+		return "", err
+	}
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+	tmp := filepath.Join(publisher.Dir, generation+".tmp")
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return "", err
+	}
+	for _, db := range publisher.dbs {
+		err := db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(filepath.Join(tmp, db.File), 0644)
+		})
+		if err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+	}
+
+	// Renames are atomic so a Follower never sees a generation half written
+	if err := os.Rename(tmp, filepath.Join(publisher.Dir, generation)); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	current := filepath.Join(publisher.Dir, currentFile)
+	if err := ioutil.WriteFile(current+".tmp", []byte(generation), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(current+".tmp", current); err != nil {
+		return "", err
+	}
+	publisher.prune()
+	return generation, nil
+}
+
+// Copies the thumbnails not published yet, each is renamed into place once
+// complete. Files other than thumbnails, e.g. ones being written, are skipped.
+func (publisher *Publisher) publishThumbnails() error {
+	if publisher.ThumbnailDir == "" {
+		return nil
+	}
+	dst := Thumbnails(publisher.Dir)
+	return filepath.Walk(publisher.ThumbnailDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // Nothing generated yet
+			}
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".jpg" {
+			return nil
+		}
+		rel, err := filepath.Rel(publisher.ThumbnailDir, path)
+		if err != nil || publisher.published[rel] {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			if err := copyFile(path, target); err != nil {
+				return err
+			}
+		}
+		publisher.published[rel] = true
+		return nil
+	})
+}
+
+// Copies the file at src to dst through a temporary file
+func copyFile(src string, dst string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dst+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(dst+".tmp", dst)
+}
+
+// Thumbnails returns the directory the thumbnails are published in by a
+// Publisher publishing in dir.
+func Thumbnails(dir string) string {
+	return filepath.Join(dir, thumbnailsDir)
+}
+
+// Removes all but the latest generations. The Followers still reading an
+// older one keep it open until they switch since the files are only unlinked.
+func (publisher *Publisher) prune() {
+	entries, err := ioutil.ReadDir(publisher.Dir)
+	if err != nil {
+		return
+	}
+	var generations []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil {
+			generations = append(generations, entry.Name())
+		}
+	}
+	sort.Strings(generations)
+	for i := 0; i < len(generations)-publisher.Keep; i++ {
+		os.RemoveAll(filepath.Join(publisher.Dir, generations[i]))
+	}
+}
+
+// Follower serves the databases of the scrapers from the generations
+// published by a Publisher, switching to each new one as it is published.
+type Follower struct {
+	Dir      string        // Directory the generations are published in
+	Interval time.Duration // Time between each check for a new generation
+	Grace    time.Duration // Time the replaced generation is kept open for reads in progress
+	OnLoad   func()        // Called after switching to a new generation
+
+	dbs     []*services.DB
+	current string
+}
+
+// NewFollower creates a Follower of the global databases of the scrapers and
+// the databases of the lists, see services.NewReplicaService.
+func NewFollower(dir string, stores []*services.DatabaseService) *Follower {
+	follower := new(Follower)
+	follower.Dir = dir
+	follower.Interval = 10 * time.Second
+	follower.Grace = time.Minute
+	follower.dbs = databases(stores)
+	return follower
+}
+
+// Load switches to the current generation if it is newer, returns true if it did.
+func (follower *Follower) Load() (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(follower.Dir, currentFile))
+	if os.IsNotExist(err) {
+		return false, ErrNotPublished
+	} else if err != nil {
+		return false, err
+	}
+	generation := strings.TrimSpace(string(data))
+	if generation == follower.current {
+		return false, nil
+	}
+
+	// Open every database first so that either all or none are switched
+	opened := make([]*bolt.DB, 0, len(follower.dbs))
+	for _, db := range follower.dbs {
+		b, err := services.OpenBolt(filepath.Join(follower.Dir, generation, db.File), true)
+		if err != nil {
+			for _, b := range opened {
+				b.Close()
+			}
+			return false, err
+		}
+		opened = append(opened, b)
+	}
+
+	var replaced []*bolt.DB
+	for i, db := range follower.dbs {
+		if old := db.Replace(opened[i]); old != nil {
+			replaced = append(replaced, old)
+		}
+	}
+	follower.current = generation
+	time.AfterFunc(follower.Grace, func() {
+		for _, b := range replaced {
+			b.Close()
+		}
+	})
+	if follower.OnLoad != nil {
+		follower.OnLoad()
+	}
+	return true, nil
+}
+
+// Start checks for new generations at the Interval until ctx is done, run as
+// a goroutine.
+func (follower *Follower) Start(ctx context.Context, debug bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(follower.Interval):
+		}
+		loaded, err := follower.Load()
+		if err != nil {
+			log.Println("Follow:", err)
+			continue
+		}
+		if loaded && debug {
+			log.Println("Switched to", follower.current)
+		}
+	}
+}
+
+// Returns the global databases of the scrapers and the databases of the lists
+func databases(stores []*services.DatabaseService) []*services.DB {
+	dbs := append([]*services.DB(nil), services.ScrapedDBs()...)
+	for _, store := range stores {
+		dbs = append(dbs, store.DB())
+	}
+	return dbs
+}
@@ -0,0 +1,124 @@
+package replica
+
+import (
+	"hnews/services"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Returns a Publisher and a Follower of the list in dir as they would be in
+// the scrape and serve processes
+func newPair(t *testing.T, dir string) (*Publisher, *services.DatabaseService, *Follower, *services.DatabaseService) {
+	if err := services.Open(t.TempDir()); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	scraped := services.NewService("top")
+	served := services.NewReplicaService("top")
+	t.Cleanup(func() {
+		scraped.Close()
+		served.Close()
+		services.Close()
+	})
+
+	publisher := NewPublisher(dir, nil)
+	publisher.dbs = []*services.DB{scraped.DB()}
+	follower := NewFollower(dir, nil)
+	follower.Grace = time.Millisecond
+	follower.dbs = []*services.DB{served.DB()}
+	return publisher, scraped, follower, served
+}
+
+func TestPublishAndFollow(t *testing.T) {
+	dir := t.TempDir()
+	publisher, scraped, follower, served := newPair(t, dir)
+	loads := 0
+	follower.OnLoad = func() { loads++ }
+
+	if _, err := follower.Load(); err != ErrNotPublished {
+		t.Fatalf("Load before any publish = %v, want %v", err, ErrNotPublished)
+	}
+
+	tests := []struct {
+		news  services.News
+		count int
+	}{
+		{services.News{ID: 1, Rank: 1, Title: "First"}, 1},
+		{services.News{ID: 2, Rank: 2, Title: "Second"}, 2},
+	}
+	for i, test := range tests {
+		scraped.SaveNews([]services.News{test.news})
+		if _, err := publisher.Publish(); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		loaded, err := follower.Load()
+		if err != nil || !loaded {
+			t.Fatalf("Load after publish %d = %v, %v, want it to switch", i+1, loaded, err)
+		}
+		if count := served.CountNews(); count != test.count {
+			t.Errorf("after publish %d the follower has %d news, want %d", i+1, count, test.count)
+		}
+		if loaded, _ := follower.Load(); loaded {
+			t.Errorf("Load again after publish %d switched, want it to stay", i+1)
+		}
+	}
+	if loads != len(tests) {
+		t.Errorf("OnLoad called %d times, want %d", loads, len(tests))
+	}
+}
+
+func TestPublishKeepsTheLatest(t *testing.T) {
+	dir := t.TempDir()
+	publisher, _, _, _ := newPair(t, dir)
+	publisher.Keep = 2
+	var latest string
+	for i := 0; i < 4; i++ {
+		generation, err := publisher.Publish()
+		if err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		latest = generation
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	var generations []string
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != thumbnailsDir {
+			generations = append(generations, entry.Name())
+		}
+	}
+	if len(generations) != 2 || generations[1] != latest {
+		t.Errorf("generations = %v, want the latest two ending with %s", generations, latest)
+	}
+	if current, _ := ioutil.ReadFile(filepath.Join(dir, currentFile)); string(current) != latest {
+		t.Errorf("%s = %q, want %q", currentFile, current, latest)
+	}
+}
+
+func TestPublishThumbnails(t *testing.T) {
+	dir, thumbnails := t.TempDir(), t.TempDir()
+	publisher, _, _, _ := newPair(t, dir)
+	publisher.ThumbnailDir = thumbnails
+	os.MkdirAll(filepath.Join(thumbnails, "ab"), 0755)
+	ioutil.WriteFile(filepath.Join(thumbnails, "ab", "ab12.jpg"), []byte("jpeg"), 0644)
+	ioutil.WriteFile(filepath.Join(thumbnails, "ab", "cd34123456"), []byte("half"), 0644)
+
+	if _, err := publisher.Publish(); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	tests := []struct {
+		file   string
+		exists bool
+	}{
+		{"ab/ab12.jpg", true},
+		{"ab/cd34123456", false},
+	}
+	for _, test := range tests {
+		_, err := os.Stat(filepath.Join(Thumbnails(dir), test.file))
+		if exists := err == nil; exists != test.exists {
+			t.Errorf("%s published = %v, want %v", test.file, exists, test.exists)
+		}
+	}
+}
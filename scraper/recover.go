@@ -0,0 +1,15 @@
+package scraper
+
+import (
+	"log"
+	"runtime/debug"
+)
+
+// Logs a panic in a scraping goroutine instead of crashing the process,
+// call deferred. A page Hacker News changed the layout of must not take the
+// API down with it.
+func recoverPanic(name string) {
+	if r := recover(); r != nil {
+		log.Println(name+": panic:", r, "\n"+string(debug.Stack()))
+	}
+}
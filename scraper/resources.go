@@ -0,0 +1,99 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"hnews/services"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Schedule is how much of a Resource is scraped and how often.
+type Schedule struct {
+	Pages    int           // Number of pages scraped each cycle
+	Interval time.Duration // Least time between the start of two cycles, 0 scrapes continuously
+}
+
+// ParserKind is the layout of the pages of a Resource, it picks how they are parsed.
+type ParserKind string
+
+// These are the ParserKinds the Scraper is able to parse
+const (
+	NewsParser ParserKind = "news" // Ranked stories like the front page
+)
+
+// Parses a page of a Resource into its News
+var parsers = map[ParserKind]func(root *html.Node) []services.News{
+	NewsParser: ParseNews,
+}
+
+// Names of the ResourceTypes as shown to clients
+var resourceTypeNames = map[ResourceType]string{
+	TopNewsType:    "top",
+	ShowNewsType:   "show",
+	NewestNewsType: "newest",
+	AskNewsType:    "ask",
+}
+
+func (resourceType ResourceType) String() string {
+	if name, ok := resourceTypeNames[resourceType]; ok {
+		return name
+	}
+	return fmt.Sprintf("ResourceType(%d)", int(resourceType))
+}
+
+// Resources are all the lists that are scraped and served by the API. Each
+// gets a Scraper and the route /v1 + URL, add an entry to offer another list.
+var Resources = []Resource{
+	{Type: TopNewsType, SourceURL: TopBaseURL, URL: "/top", Name: "top",
+		Parser: NewsParser, Schedule: Schedule{Pages: 16}, ReadArticles: true},
+	{Type: AskNewsType, SourceURL: AskBaseURL, URL: "/ask", Name: "ask",
+		Parser: NewsParser, Schedule: Schedule{Pages: 16}},
+	{Type: ShowNewsType, SourceURL: ShowBaseURL, URL: "/show", Name: "show",
+		Parser: NewsParser, Schedule: Schedule{Pages: 16}, ReadArticles: true},
+	{Type: NewestNewsType, SourceURL: NewestBaseURL, URL: "/newest", Name: "newest",
+		Parser: NewsParser, Schedule: Schedule{Pages: 16}},
+}
+
+// ErrUnknownResource is returned when no Resource has the given name
+var ErrUnknownResource = errors.New("scraper: unknown resource")
+
+// LookupResource returns the Resource with the given name.
+func LookupResource(resources []Resource, name string) (Resource, error) {
+	for _, resource := range resources {
+		if resource.Name == name {
+			return resource, nil
+		}
+	}
+	return Resource{}, ErrUnknownResource
+}
+
+// ValidateResources returns an error if a Resource is incomplete or clashes
+// with another one by name or URL.
+func ValidateResources(resources []Resource) error {
+	names := make(map[string]bool)
+	urls := make(map[string]bool)
+	for _, resource := range resources {
+		switch {
+		case resource.Name == "":
+			return fmt.Errorf("scraper: resource %q has no name", resource.URL)
+		case !strings.HasPrefix(resource.URL, "/"):
+			return fmt.Errorf("scraper: URL of resource %s must start with /", resource.Name)
+		case !strings.HasPrefix(string(resource.SourceURL), BaseURL):
+			return fmt.Errorf("scraper: source URL of resource %s is not on %s", resource.Name, BaseURL)
+		case parsers[resource.Parser] == nil:
+			return fmt.Errorf("scraper: resource %s has unknown parser %q", resource.Name, resource.Parser)
+		case resource.Schedule.Pages < 1 || resource.Schedule.Interval < 0:
+			return fmt.Errorf("scraper: resource %s has a bad schedule", resource.Name)
+		case names[resource.Name]:
+			return fmt.Errorf("scraper: resource name %s is used twice", resource.Name)
+		case urls[resource.URL]:
+			return fmt.Errorf("scraper: resource URL %s is used twice", resource.URL)
+		}
+		names[resource.Name] = true
+		urls[resource.URL] = true
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package scraper
 
 import (
+	"context"
 	"errors"
 	"hnews/services"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,6 +26,9 @@ type Resource struct {
 	SourceURL    ResourceURL               // URL from which this resource is fetched from
 	URL          string                    // API URL for this resource
 	Name         string                    // Human readable name of the resource
+	Parser       ParserKind                // Layout of the pages of the resource
+	Schedule     Schedule                  // How much of the resource is scraped and how often
+	ReadArticles bool                      // Extract the linked articles for offline reading
 	BackingStore *services.DatabaseService // DatabaseService backing this resource
 }
 
@@ -50,83 +56,282 @@ const (
 
 // Scraper scrapes a specific resource of News from Hacker News.
 type Scraper struct {
+	Name            string // Name of the Resource being scraped
 	ResourceType    ResourceType
 	ResourceURL     ResourceURL
+	Schedule        Schedule
 	DatabaseService *services.DatabaseService
+
+	parse      func(root *html.Node) []services.News // Parses a page of the Resource
+	cycleHooks []CycleFunc
 }
 
+// CycleFunc is called with the name of the Resource and all of its News
+// ordered by rank each time a Scraper has scraped all of its pages.
+type CycleFunc func(name string, news []services.News)
+
 // NewScraper allocated and inits a Scraper with it's database in the background
 func NewScraper(resource Resource) *Scraper {
 	scraper := new(Scraper)
+	scraper.Name = resource.Name
 	scraper.ResourceType = resource.Type
 	scraper.ResourceURL = resource.SourceURL
+	scraper.Schedule = resource.Schedule
+	scraper.parse = parsers[resource.Parser]
 	scraper.DatabaseService = services.NewService(resource.Name)
 	return scraper
 }
 
-// StartScraper starts the scraping and never returns, run as a goroutine.
-func (scraper *Scraper) StartScraper(debug bool) {
+// OnCycle registers fn to be called after every scrape cycle. Not safe to call
+// after StartScraper.
+func (scraper *Scraper) OnCycle(fn CycleFunc) {
+	scraper.cycleHooks = append(scraper.cycleHooks, fn)
+}
+
+// StartScraper starts the scraping, run as a goroutine. Once ctx is done no
+// more pages are fetched and it returns after the pages in progress are saved.
+func (scraper *Scraper) StartScraper(ctx context.Context, debug bool) {
 	newsCh := make(chan []services.News)
+	cycleCh := make(chan bool)
 	commentsCh := make(chan []services.Comment)
-	go scraper.scrapePages(newsCh)
-	go scraper.scrapeComments(commentsCh)
 
+	// The channels are read until both the pages and the comments have stopped
+	var producers sync.WaitGroup
+	producers.Add(2)
+	go func() {
+		defer producers.Done()
+		scraper.scrapePages(ctx, newsCh, cycleCh)
+	}()
+	go func() {
+		defer producers.Done()
+		scraper.scrapeComments(ctx, commentsCh)
+	}()
+	stopped := make(chan bool)
+	go func() {
+		producers.Wait()
+		close(stopped)
+	}()
+
+	var saves sync.WaitGroup
+	save := func(fn func()) {
+		saves.Add(1)
+		go func() {
+			defer saves.Done()
+			fn()
+		}()
+	}
+	defer saves.Wait()
+
+	var cycle []services.News // All the News scraped during the current cycle
 	for {
 		select {
+		case <-stopped:
+			return
 		case newNews := <-newsCh:
 			if debug {
 				log.Println(len(newNews), "new news.")
 			}
-			go scraper.DatabaseService.SaveNews(newNews)
+			save(func() { scraper.DatabaseService.SaveNews(newNews) })
+			// Samples are appended before the cycle hooks run since they depend on them
+			services.AppendSamples(scraper.Name, newNews)
+			cycle = append(cycle, newNews...)
+		case <-cycleCh:
+			sort.Sort(byRank(cycle))
+			services.SaveSnapshot(scraper.Name, time.Now(), cycle)
+			for _, hook := range scraper.cycleHooks {
+				scraper.runHook(hook, cycle)
+			}
+			cycle = nil
 		case newComments := <-commentsCh:
 			if debug {
 				log.Println(len(newComments), "new comments.")
 			}
-			go services.SaveComments(newComments) // Save to the global db instance
+			save(func() { services.SaveComments(newComments) }) // Save to the global db instance
 		}
 	}
 }
 
+// Runs a cycle hook, a panic in it does not stop the scraper
+func (scraper *Scraper) runHook(hook CycleFunc, cycle []services.News) {
+	defer recoverPanic("OnCycle")
+	hook(scraper.Name, cycle)
+}
+
 /********************** News **********************/
-// Starts the download of all News pages. Sends []News on the channel
-func (scraper *Scraper) scrapePages(newsCh chan []services.News) {
+// Starts the download of all News pages. Sends []News on the channel and
+// signals cycleCh once all the pages has been scraped. Returns once ctx is
+// done, without signaling the cycle that was cut short.
+func (scraper *Scraper) scrapePages(ctx context.Context, newsCh chan []services.News, cycleCh chan bool) {
 	var wg sync.WaitGroup
 	for {
-		for id := 1; id <= 16; id++ {
+		start := time.Now()
+		for id := 1; id <= scraper.Schedule.Pages; id++ {
 			wg.Add(1)
-			go scrapePage(id, string(scraper.ResourceURL), newsCh, &wg)
+			go scraper.scrapePage(ctx, id, newsCh, &wg)
 		}
 		wg.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+		cycleCh <- true
+		if !sleep(ctx, scraper.Schedule.Interval-time.Since(start)) {
+			return
+		}
 	}
 }
 
-// Scrapes one page of News from a the given ResourceURL on the Scraper type
-func scrapePage(id int, pageURL string, newsCh chan []services.News, wg *sync.WaitGroup) {
-	var news []services.News
+// Sorts News by rank
+type byRank []services.News
+
+func (news byRank) Len() int           { return len(news) }
+func (news byRank) Swap(i, j int)      { news[i], news[j] = news[j], news[i] }
+func (news byRank) Less(i, j int) bool { return news[i].Rank < news[j].Rank }
+
+// Scrapes one page of News from the ResourceURL of the Scraper
+func (scraper *Scraper) scrapePage(ctx context.Context, id int, newsCh chan []services.News, wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer recoverPanic("scrapePage")
 
-	url := pageURL + strconv.Itoa(id)
+	news, err := scraper.fetchNews(ctx, id)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Println(err)
+		}
+		return
+	}
+	if len(news) == 0 {
+		return
+	}
+	newsCh <- news
+}
+
+// Downloads and parses the page with the given number of the Resource
+func (scraper *Scraper) fetchNews(ctx context.Context, page int) ([]services.News, error) {
+	root, err := fetchPage(ctx, string(scraper.ResourceURL)+strconv.Itoa(page))
+	if err != nil {
+		return nil, err
+	}
+	return scraper.parse(root), nil
+}
 
+// Summary describes one scrape cycle of a Resource.
+type Summary struct {
+	Name   string
+	Pages  int             // Pages fetched
+	Failed map[int]error   // Pages that could not be fetched by page number
+	News   []services.News // Ordered by rank
+	Took   time.Duration
+}
+
+// ScrapeOnce scrapes all the pages of the Resource one time and returns what
+// was found. The News are saved like in a cycle of StartScraper if save is
+// set, without running the cycle hooks. The pages not fetched before ctx is
+// done are failed.
+func (scraper *Scraper) ScrapeOnce(ctx context.Context, save bool) Summary {
+	start := time.Now()
+	summary := Summary{Name: scraper.Name, Pages: scraper.Schedule.Pages, Failed: make(map[int]error)}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for id := 1; id <= scraper.Schedule.Pages; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			defer recoverPanic("ScrapeOnce")
+			news, err := scraper.fetchNews(ctx, id)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				summary.Failed[id] = err
+				return
+			}
+			summary.News = append(summary.News, news...)
+		}(id)
+	}
+	wg.Wait()
+	sort.Sort(byRank(summary.News))
+
+	if save && len(summary.News) > 0 {
+		scraper.DatabaseService.SaveNews(summary.News)
+		services.AppendSamples(scraper.Name, summary.News)
+		services.SaveSnapshot(scraper.Name, time.Now(), summary.News)
+	}
+	summary.Took = time.Since(start)
+	return summary
+}
+
+// RetryTimeout is the most time spent retrying a page while Hacker News is busy.
+var RetryTimeout = 15 * time.Minute
+
+// Downloads the pages, giving up on a single request after a minute
+// so that a stalled connection doesn't hold up a whole scrape cycle.
+var client = &http.Client{Timeout: time.Minute}
+
+// Downloads and parses the HTML page at url, retrying while Hacker News is
+// busy. Gives up as soon as ctx is done.
+func fetchPage(ctx context.Context, url string) (*html.Node, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
 	var resp *http.Response
 	operation := func() error {
 		var err error
-		resp, err = http.Get(url)
-		if err != nil || resp.StatusCode != http.StatusOK {
+		resp, err = client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
 			return errors.New("Server busy.")
 		}
 		return nil
 	}
 
-	backoff.Retry(operation, backoff.NewExponentialBackOff())
-
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = RetryTimeout
+	if err := retry(ctx, operation, b); err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
-	root, err := html.Parse(resp.Body)
-	if err != nil {
-		log.Println(err)
-		return
+	return html.Parse(resp.Body)
+}
+
+// Like backoff.Retry but stops waiting for the next attempt once ctx is done
+func retry(ctx context.Context, operation backoff.Operation, b backoff.BackOff) error {
+	b.Reset()
+	for {
+		err := operation()
+		if err == nil {
+			return nil
+		}
+		next := b.NextBackOff()
+		if next == backoff.Stop {
+			return err
+		}
+		if !sleep(ctx, next) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Sleeps for d, returns false without waiting it out if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
+}
 
+// ParseNews parses all the News on a page of News.
+func ParseNews(root *html.Node) []services.News {
 	pointsCh := make(chan []int)
 	ranksCh := make(chan []int)
 	titlesCh := make(chan []string)
@@ -153,9 +358,14 @@ func scrapePage(id int, pageURL string, newsCh chan []services.News, wg *sync.Wa
 	comments := <-commentsCh
 	ids := <-idsCh
 
+	var news []services.News
 	for i := 0; i < len(ranks); i++ {
 		rank := int32(ranks[i])
-		title := titles[i]
+
+		var title string
+		if i < len(titles) {
+			title = titles[i]
+		}
 
 		var time time.Time
 		if i < len(times) {
@@ -187,12 +397,10 @@ func scrapePage(id int, pageURL string, newsCh chan []services.News, wg *sync.Wa
 			id = int32(ids[i])
 		}
 
-		news = append(news, services.News{id, rank, title, link, author, numPoints, time, numComments})
+		news = append(news, services.News{ID: id, Rank: rank, Title: title, Link: link, Domain: linkDomain(link),
+			Author: author, Points: numPoints, Time: time, Comments: numComments})
 	}
-	if len(news) == 0 {
-		return
-	}
-	newsCh <- news
+	return news
 }
 
 // Parses out the rank of the articles.
@@ -358,7 +566,7 @@ func parseArticles(root *html.Node, titleCh chan []string, linksCh chan []string
 	articles := scrape.FindAll(root, matcher)
 	for _, article := range articles {
 		title := scrape.Text(article)
-		link := scrape.Attr(article, "href")
+		link := absoluteLink(scrape.Attr(article, "href"))
 		titles = append(titles, title)
 		links = append(links, link)
 	}
@@ -366,6 +574,32 @@ func parseArticles(root *html.Node, titleCh chan []string, linksCh chan []string
 	linksCh <- links
 }
 
+// BaseURL is what links on Hacker News are relative to, e.g. self posts
+const BaseURL = "https://news.ycombinator.com/"
+
+// Resolves links relative to Hacker News into absolute URLs
+func absoluteLink(link string) string {
+	base, _ := url.Parse(BaseURL)
+	ref, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// Returns the domain of the link without www.
+func linkDomain(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
 func parsePoints(root *html.Node, pointsCh chan []int) {
 	matcher := func(n *html.Node) bool {
 		if n.DataAtom == atom.Span && n.Parent != nil {
@@ -392,45 +626,216 @@ func parsePoints(root *html.Node, pointsCh chan []int) {
 
 /********************** News **********************/
 
-/******************** Comments ********************/
-// Scrapes the Comments for every News item currently in the database.
-func (scraper *Scraper) scrapeComments(commentsCh chan []services.Comment) {
+/******************** Archive *********************/
+// FrontBaseURL is the front page of Hacker News for a day formatted as 2006-01-02
+const FrontBaseURL = "https://news.ycombinator.com/front?day="
+
+// Number of pages of each day that is backfilled
+const frontPages = 3
+
+// Backfill archives the front pages of the given number of days before today
+// that has not already been backfilled, returns early once ctx is done.
+func Backfill(ctx context.Context, days int, debug bool) {
+	defer recoverPanic("Backfill")
+	now := time.Now().UTC()
+	for d := 1; d <= days && ctx.Err() == nil; d++ {
+		day := now.AddDate(0, 0, -d).Format("2006-01-02")
+		if services.HasFront(day) {
+			continue
+		}
+
+		var news []services.News
+		for p := 1; p <= frontPages; p++ {
+			root, err := fetchPage(ctx, FrontBaseURL+day+"&p="+strconv.Itoa(p))
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Println(err)
+				}
+				break
+			}
+			news = append(news, ParseNews(root)...)
+		}
+		if len(news) == 0 || ctx.Err() != nil {
+			continue // A day cut short is backfilled on the next start
+		}
+		if debug {
+			log.Println(len(news), "news backfilled for", day)
+		}
+		services.SaveFront(day, news)
+	}
+}
+
+/******************** Archive *********************/
+
+/******************** Tracking ********************/
+// How often the News that left the lists are scraped from their item pages
+const trackInterval = 10 * time.Minute
+
+// News not seen on any list for at least this long are considered to have
+// left the lists, see StaleAfter
+const minTrackStale = 5 * time.Minute
+
+// StaleAfter returns how long a News must not have been seen on any of the
+// lists to have left them: two scrape cycles of the list scraped least often,
+// so that a News still on a list is never tracked, or minTrackStale.
+func StaleAfter(resources []Resource) time.Duration {
+	stale := minTrackStale
+	for _, resource := range resources {
+		if cycles := 2 * resource.Schedule.Interval; cycles > stale {
+			stale = cycles
+		}
+	}
+	return stale
+}
+
+// StartTracker keeps appending Samples for News for period after they left
+// all the lists, i.e. were not seen on them for stale, by scraping their item
+// pages. Run as a goroutine, returns once ctx is done and the items in
+// progress are saved.
+func StartTracker(ctx context.Context, period time.Duration, stale time.Duration, debug bool) {
 	var wg sync.WaitGroup
 	for {
+		ids := services.OffListIDs(stale, period)
+		if debug {
+			log.Println(len(ids), "tracked news off the lists.")
+		}
+		for _, id := range ids {
+			wg.Add(1)
+			go trackItem(ctx, id, &wg)
+		}
+		wg.Wait()
+		if !sleep(ctx, trackInterval) {
+			return
+		}
+	}
+}
+
+// Scrapes the item page of a News and appends a Sample to its History
+func trackItem(ctx context.Context, newsid int32, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer recoverPanic("trackItem")
+
+	root, err := fetchPage(ctx, "https://news.ycombinator.com/item?id="+strconv.Itoa(int(newsid)))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	news, ok := parseItem(root)
+	if !ok {
+		return
+	}
+	news.ID = newsid
+	services.TrackSample(news)
+}
+
+// ErrNoNews is returned when there is no News on an item page, e.g. for a comment
+var ErrNoNews = errors.New("scraper: no news on item page")
+
+// FetchNews scrapes the News with the given id from its item page, e.g. when
+// it is needed but has never been seen on a list.
+func FetchNews(ctx context.Context, newsid int32) (services.News, error) {
+	root, err := fetchPage(ctx, "https://news.ycombinator.com/item?id="+strconv.Itoa(int(newsid)))
+	if err != nil {
+		return services.News{}, err
+	}
+	news, ok := parseItem(root)
+	if !ok {
+		return news, ErrNoNews
+	}
+	news.ID = newsid
+	return news, nil
+}
+
+// Parses the News at the top of an item page, which has no rank.
+func parseItem(root *html.Node) (services.News, bool) {
+	pointsCh := make(chan []int)
+	titlesCh := make(chan []string)
+	linksCh := make(chan []string)
+	authorsCh := make(chan []string)
+	commentsCh := make(chan []int)
+
+	go parsePoints(root, pointsCh)
+	go parseArticles(root, titlesCh, linksCh)
+	go parseAuthors(root, authorsCh)
+	go parseNumComments(root, commentsCh)
+
+	points := <-pointsCh
+	titles := <-titlesCh
+	links := <-linksCh
+	authors := <-authorsCh
+	comments := <-commentsCh
+
+	var news services.News
+	if len(titles) == 0 {
+		return news, false
+	}
+	news.Title = titles[0]
+	if len(links) > 0 {
+		news.Link = links[0]
+		news.Domain = linkDomain(news.Link)
+	}
+	if len(authors) > 0 {
+		news.Author = authors[0]
+	}
+	if len(points) > 0 {
+		news.Points = int32(points[0])
+	}
+	if len(comments) > 0 {
+		news.Comments = int32(comments[0])
+	}
+	return news, true
+}
+
+/******************** Tracking ********************/
+
+/******************** Comments ********************/
+// Scrapes the Comments for every News item currently in the database until
+// ctx is done.
+func (scraper *Scraper) scrapeComments(ctx context.Context, commentsCh chan []services.Comment) {
+	var wg sync.WaitGroup
+	for ctx.Err() == nil {
 		ids := scraper.DatabaseService.ReadNewsIds()
 		for _, id := range ids {
 			wg.Add(1)
-			go parseComments(id, commentsCh, &wg)
+			go parseComments(ctx, id, commentsCh, &wg)
 		}
 		wg.Wait()
 	}
 }
 
 // Parses all the Comments for a particular News item.
-func parseComments(newsid int32, commentsCh chan []services.Comment,
+func parseComments(ctx context.Context, newsid int32, commentsCh chan []services.Comment,
 	wg *sync.WaitGroup) {
 	defer wg.Done()
-	url := "https://news.ycombinator.com/item?id=" + strconv.Itoa(int(newsid))
+	defer recoverPanic("parseComments")
 
-	var resp *http.Response
-	operation := func() error {
-		var err error
-		resp, err = http.Get(url)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			return errors.New("Server busy.")
+	root, err := fetchPage(ctx, "https://news.ycombinator.com/item?id="+strconv.Itoa(int(newsid)))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Println(err)
 		}
-		return nil
+		return
 	}
+	commentsCh <- ParseComments(root, newsid)
+}
 
-	backoff.Retry(operation, backoff.NewExponentialBackOff())
-	defer resp.Body.Close()
-
-	root, err := html.Parse(resp.Body)
+// RefreshComments scrapes the Comments of the News with the given id right
+// away, e.g. after one of them was edited, and replaces the stored thread.
+func RefreshComments(ctx context.Context, newsid int32) error {
+	root, err := fetchPage(ctx, "https://news.ycombinator.com/item?id="+strconv.Itoa(int(newsid)))
 	if err != nil {
-		log.Println(err)
-		return
+		return err
 	}
+	services.ReplaceComments(newsid, ParseComments(root, newsid))
+	return nil
+}
 
+// ParseComments parses all the Comments on a page of Comments, such as the
+// item page of the News with the given id.
+func ParseComments(root *html.Node, newsid int32) []services.Comment {
 	offsetsCh := make(chan []int)
 	idsCh := make(chan []int)
 	authorsCh := make(chan []string)
@@ -477,11 +882,11 @@ func parseComments(newsid int32, commentsCh chan []services.Comment,
 			text = texts[i]
 		}
 
-		comment := services.Comment{int32(i + 1), newsid, id, offset,
-			timestamp, author, text}
+		comment := services.Comment{Num: int32(i + 1), ParentID: newsid, ID: id, Offset: offset,
+			Time: timestamp, Author: author, Text: text}
 		comments = append(comments, comment)
 	}
-	commentsCh <- comments
+	return comments
 }
 
 // Parses the level for each Comment in the comment tree. Interval: 0-inf.
@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const newsPage = `<html><body><table>
+<tr class="athing" id="11"><td><span class="rank">1.</span></td><td><a href="https://www.example.com/a">First story</a></td></tr>
+<tr><td class="subtext"><span class="score" id="score_11">120 points</span> by <a href="user?id=alice">alice</a> <span class="age"><a href="item?id=11">3 hours ago</a></span> | <a href="item?id=11">45&nbsp;comments</a></td></tr>
+<tr class="athing" id="12"><td><span class="rank">2.</span></td><td><a href="item?id=12">Ask HN: Second</a></td></tr>
+<tr><td class="subtext"><span class="score" id="score_12">7 points</span> by <a href="user?id=bob">bob</a> <span class="age"><a href="item?id=12">20 minutes ago</a></span> | <a href="item?id=12">discuss</a></td></tr>
+</table></body></html>`
+
+func TestParseNews(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(newsPage))
+	if err != nil {
+		t.Fatalf("html.Parse: %v", err)
+	}
+	news := ParseNews(root)
+	if len(news) != 2 {
+		t.Fatalf("ParseNews found %d news, want 2", len(news))
+	}
+
+	first, second := news[0], news[1]
+	if first.ID != 11 || first.Rank != 1 || first.Title != "First story" || first.Author != "alice" ||
+		first.Points != 120 || first.Comments != 45 || first.Domain != "example.com" {
+		t.Errorf("first news = %+v", first)
+	}
+	if age := time.Since(first.Time); age < 3*time.Hour-time.Minute || age > 3*time.Hour+time.Minute {
+		t.Errorf("first news posted %v ago, want 3 hours", age)
+	}
+	if second.ID != 12 || second.Link != "https://news.ycombinator.com/item?id=12" || second.Domain != "news.ycombinator.com" || second.Comments != 0 {
+		t.Errorf("second news = %+v", second)
+	}
+}
+
+func TestParseTimeString(t *testing.T) {
+	tests := []struct {
+		text string
+		ago  time.Duration
+	}{
+		{"5 minutes ago", 5 * time.Minute},
+		{"1 hour ago", time.Hour},
+		{"4 hours ago", 4 * time.Hour},
+		{"1 day ago", 24 * time.Hour},
+		{"41 days ago", 41 * 24 * time.Hour},
+	}
+	for _, test := range tests {
+		got, err := parseTimeString(test.text)
+		if err != nil {
+			t.Errorf("parseTimeString(%q): %v", test.text, err)
+			continue
+		}
+		if ago := time.Since(got); ago < test.ago || ago > test.ago+time.Minute {
+			t.Errorf("parseTimeString(%q) is %v ago, want %v", test.text, ago, test.ago)
+		}
+	}
+	if _, err := parseTimeString("yesterday ago"); err == nil {
+		t.Error("parseTimeString of a word succeeded")
+	}
+}
+
+func TestLinkDomain(t *testing.T) {
+	tests := []struct {
+		link, want string
+	}{
+		{"https://www.Example.com/a", "example.com"},
+		{"http://blog.example.com:8080/b", "blog.example.com"},
+		{"https://news.ycombinator.com/item?id=1", "news.ycombinator.com"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := linkDomain(test.link); got != test.want {
+			t.Errorf("linkDomain(%q) = %q, want %q", test.link, got, test.want)
+		}
+	}
+}
+
+func TestStaleAfter(t *testing.T) {
+	tests := []struct {
+		intervals []time.Duration
+		want      time.Duration
+	}{
+		{nil, minTrackStale},
+		{[]time.Duration{0, time.Minute}, minTrackStale},
+		{[]time.Duration{0, 10 * time.Minute, time.Minute}, 20 * time.Minute},
+		{[]time.Duration{time.Hour}, 2 * time.Hour},
+	}
+	for _, test := range tests {
+		var resources []Resource
+		for _, interval := range test.intervals {
+			resources = append(resources, Resource{Schedule: Schedule{Interval: interval}})
+		}
+		if got := StaleAfter(resources); got != test.want {
+			t.Errorf("StaleAfter(%v) = %v, want %v", test.intervals, got, test.want)
+		}
+	}
+}
+
+// The top of the item page of a story, which has no rank
+const itemPage = `<html><body><table>
+<tr class="athing" id="11"><td><a href="https://www.example.com/a">First story</a></td></tr>
+<tr><td class="subtext"><span class="score" id="score_11">120 points</span> by <a href="user?id=alice">alice</a> <span class="age"><a href="item?id=11">3 hours ago</a></span> | <a href="item?id=11">45&nbsp;comments</a></td></tr>
+</table></body></html>`
+
+func TestParseItem(t *testing.T) {
+	tests := []struct {
+		page   string
+		wantOK bool
+	}{
+		{itemPage, true},
+		{`<html><body>No such item.</body></html>`, false},
+	}
+	for _, test := range tests {
+		root, err := html.Parse(strings.NewReader(test.page))
+		if err != nil {
+			t.Fatalf("html.Parse: %v", err)
+		}
+		news, ok := parseItem(root)
+		if ok != test.wantOK {
+			t.Errorf("parseItem(%q) = %v, want %v", test.page, ok, test.wantOK)
+			continue
+		}
+		if ok && (news.Title != "First story" || news.Link != "https://www.example.com/a" || news.Domain != "example.com" ||
+			news.Author != "alice" || news.Points != 120 || news.Comments != 45) {
+			t.Errorf("parseItem = %+v", news)
+		}
+	}
+}
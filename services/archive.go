@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// There is a only one single database for the archive of all the lists
+var (
+	Archivedb = newDB("archive-global")
+)
+
+// Days of the front page backfilled from Hacker News are kept in this bucket
+// while every list has a bucket of snapshots named after itself.
+var archiveFrontKey = []byte("front?day")
+
+// Walks back at most this many Samples looking for the title at a snapshot.
+const maxTitleLookback = 64
+
+// SaveSnapshot archives the ranking of the list at the given time. Only the
+// ranks and ids are stored, the rest is restored from the History of each News.
+func SaveSnapshot(list string, at time.Time, news []News) {
+	var ranks bytes.Buffer
+	for _, aNews := range news {
+		binary.Write(&ranks, binary.LittleEndian, aNews.Rank)
+		binary.Write(&ranks, binary.LittleEndian, aNews.ID)
+	}
+	Archivedb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(list))
+		if err != nil {
+			log.Println("SaveSnapshot:", err)
+			return err
+		}
+		return b.Put(sampleKey(at), ranks.Bytes())
+	})
+}
+
+// ReadSnapshot returns the latest snapshot of the list taken at or before at
+// and the time it was taken.
+func ReadSnapshot(list string, at time.Time) (time.Time, []News) {
+	taken, ranks, _ := readRanks(list, at)
+	return taken, rebuildNews(taken, ranks)
+}
+
+// ReadSnapshotPage returns limit News from offset of the latest snapshot of
+// the list taken at or before at, the time it was taken and the number of
+// News in it. The News have the rank they had in the snapshot before.
+func ReadSnapshotPage(list string, at time.Time, offset int, limit int) (time.Time, []News, int) {
+	taken, ranks, prev := readRanks(list, at)
+	ranks = sampledRanks(ranks)
+	total := len(ranks)
+	if offset >= total {
+		return taken, []News{}, total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	news := rebuildNews(taken, ranks[offset:end])
+	for i := range news {
+		if rank, ok := prev[news[i].ID]; ok {
+			news[i].PrevRank = rank
+			news[i].RankDelta = rank - news[i].Rank
+		}
+	}
+	annotateLinks(news)
+	return taken, news, total
+}
+
+// A News on a list in a snapshot
+type snapshotRank struct {
+	rank int32
+	id   int32
+}
+
+// Returns the time and ranks of the latest snapshot of the list taken at or
+// before at together with the ranks of the snapshot before it by id
+func readRanks(list string, at time.Time) (time.Time, []snapshotRank, map[int32]int32) {
+	var taken time.Time
+	var ranks []snapshotRank
+	prev := make(map[int32]int32)
+	Archivedb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(list))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		k, v := seekAtOrBefore(c, at)
+		if k == nil {
+			return nil
+		}
+
+		taken = sampleTime(k)
+		ranks = decodeRanks(v)
+		if _, v := c.Prev(); v != nil {
+			for _, r := range decodeRanks(v) {
+				prev[r.id] = r.rank
+			}
+		}
+		return nil
+	})
+	return taken, ranks, prev
+}
+
+// Snapshots are stored as pairs of rank and id
+func decodeRanks(v []byte) []snapshotRank {
+	var ranks []snapshotRank
+	r := bytes.NewReader(v)
+	for r.Len() >= 8 {
+		var rank snapshotRank
+		binary.Read(r, binary.LittleEndian, &rank.rank)
+		binary.Read(r, binary.LittleEndian, &rank.id)
+		ranks = append(ranks, rank)
+	}
+	return ranks
+}
+
+// Returns the ranks of the News that have a History to be restored from, so
+// that every page but the last is full and the total is what can be paged through
+func sampledRanks(ranks []snapshotRank) []snapshotRank {
+	sampled := make([]snapshotRank, 0, len(ranks))
+	Historydb.View(func(tx *bolt.Tx) error {
+		for _, r := range ranks {
+			if b := tx.Bucket([]byte(strconv.Itoa(int(r.id)))); b != nil && b.Get(historyNewsKey) != nil {
+				sampled = append(sampled, r)
+			}
+		}
+		return nil
+	})
+	return sampled
+}
+
+// PruneSnapshots deletes the snapshots of the lists taken before. The front
+// page of every day is kept first, as the last snapshot of the top list that day.
+func PruneSnapshots(before time.Time) {
+	keepFronts(before)
+	to := sampleKey(before)
+	Archivedb.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if bytes.Equal(name, archiveFrontKey) {
+				return nil
+			}
+			if err := deleteBefore(b, to); err != nil {
+				log.Println("PruneSnapshots:", err)
+				return err
+			}
+			return nil
+		})
+	})
+}
+
+// Saves the front page of the days that end before from the snapshots of
+// the top list, unless it was backfilled
+func keepFronts(before time.Time) {
+	var first time.Time
+	Archivedb.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("top")); b != nil {
+			if k, _ := b.Cursor().First(); k != nil {
+				first = sampleTime(k)
+			}
+		}
+		return nil
+	})
+	if first.IsZero() {
+		return
+	}
+	for day := first.UTC().Truncate(24 * time.Hour); !day.AddDate(0, 0, 1).After(before); day = day.AddDate(0, 0, 1) {
+		name := day.Format("2006-01-02")
+		if HasFront(name) {
+			continue
+		}
+		if news := ReadFront(name); len(news) > 0 {
+			SaveFront(name, news)
+		}
+	}
+}
+
+// Restores the ranked News as they were when the snapshot was taken
+func rebuildNews(taken time.Time, ranks []snapshotRank) []News {
+	if len(ranks) == 0 {
+		return nil
+	}
+	news := make([]News, 0, len(ranks))
+	Historydb.View(func(tx *bolt.Tx) error {
+		for _, r := range ranks {
+			aNews, ok := newsAt(tx, r.id, taken)
+			if !ok {
+				continue
+			}
+			aNews.Rank = r.rank
+			news = append(news, aNews)
+		}
+		return nil
+	})
+	return news
+}
+
+// Restores a News as it was at the given time from its History
+func newsAt(tx *bolt.Tx, newsid int32, at time.Time) (News, bool) {
+	var news News
+	b := tx.Bucket([]byte(strconv.Itoa(int(newsid))))
+	if b == nil {
+		return news, false
+	}
+	if err := json.Unmarshal(b.Get(historyNewsKey), &news); err != nil {
+		return news, false
+	}
+	news.PrevRank = 0
+	news.RankDelta = 0
+
+	samples := b.Bucket(historySamplesKey)
+	if samples == nil {
+		return news, true
+	}
+	c := samples.Cursor()
+	k, v := seekAtOrBefore(c, at)
+	if k == nil {
+		return news, true
+	}
+	sample := decodeSample(k, v)
+	news.Points = sample.Points
+	news.Comments = sample.Comments
+
+	// The title is only sampled when it changes
+	for i := 0; k != nil && i < maxTitleLookback; i++ {
+		if title := decodeSample(k, v).Title; title != "" {
+			news.Title = title
+			break
+		}
+		k, v = c.Prev()
+	}
+	return news, true
+}
+
+// SaveFront archives the front page of a day, formatted as 2006-01-02, as
+// backfilled from Hacker News.
+func SaveFront(day string, news []News) {
+	v, err := json.Marshal(news)
+	if err != nil {
+		log.Println("SaveFront:", err)
+		return
+	}
+	Archivedb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(archiveFrontKey)
+		if err != nil {
+			log.Println("SaveFront:", err)
+			return err
+		}
+		return b.Put([]byte(day), v)
+	})
+}
+
+// ReadFront returns the front page of a day, formatted as 2006-01-02. Uses
+// the backfilled front page if there is one, otherwise the last snapshot of
+// the top list taken that day.
+func ReadFront(day string) []News {
+	var news []News
+	Archivedb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(archiveFrontKey)
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(day)); v != nil {
+			json.Unmarshal(v, &news)
+		}
+		return nil
+	})
+	if news != nil {
+		return news
+	}
+
+	start, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return nil
+	}
+	taken, news := ReadSnapshot("top", start.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if taken.Before(start) {
+		return nil
+	}
+	return news
+}
+
+// HasFront returns true if the front page of the day has been backfilled.
+func HasFront(day string) bool {
+	found := false
+	Archivedb.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(archiveFrontKey); b != nil {
+			found = b.Get([]byte(day)) != nil
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// Archives the News on the list as scraped at the given time
+func snapshotAt(t *testing.T, list string, at time.Time, news ...News) {
+	for i := range news {
+		news[i].Rank = int32(i + 1)
+	}
+	appendAt(t, list, at, news...)
+	SaveSnapshot(list, at, news)
+}
+
+func TestReadSnapshot(t *testing.T) {
+	openTemp(t)
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	snapshotAt(t, "top", start, News{ID: 1, Title: "First", Points: 1}, News{ID: 2, Title: "Second"})
+	snapshotAt(t, "top", start.Add(time.Hour), News{ID: 2, Title: "Second", Points: 7}, News{ID: 1, Title: "First", Points: 3})
+
+	tests := []struct {
+		at     time.Time
+		taken  time.Time
+		first  int32
+		points int32
+	}{
+		{start, start, 1, 1},
+		{start.Add(30 * time.Minute), start, 1, 1},
+		{start.Add(time.Hour), start.Add(time.Hour), 2, 7},
+		{start.Add(48 * time.Hour), start.Add(time.Hour), 2, 7},
+	}
+	for _, test := range tests {
+		taken, news := ReadSnapshot("top", test.at)
+		if !taken.Equal(test.taken) || len(news) != 2 || news[0].ID != test.first || news[0].Points != test.points {
+			t.Errorf("ReadSnapshot(%v) = %v, %+v, want news %d with %d points taken %v", test.at, taken, news, test.first, test.points, test.taken)
+		}
+	}
+	if taken, news := ReadSnapshot("top", start.Add(-time.Second)); !taken.IsZero() || news != nil {
+		t.Errorf("ReadSnapshot before the first = %v, %+v, want nothing", taken, news)
+	}
+}
+
+func TestReadSnapshotPageSkipsUnsampled(t *testing.T) {
+	openTemp(t)
+	at := time.Now()
+	appendAt(t, "top", at, News{ID: 1, Rank: 1}, News{ID: 3, Rank: 3})
+	// News 2 has no History to be restored from
+	SaveSnapshot("top", at, []News{{ID: 1, Rank: 1}, {ID: 2, Rank: 2}, {ID: 3, Rank: 3}})
+
+	_, news, total := ReadSnapshotPage("top", at, 0, 1)
+	if total != 2 || len(news) != 1 || news[0].ID != 1 {
+		t.Errorf("first page = %+v of %d, want news 1 of 2", news, total)
+	}
+	_, news, total = ReadSnapshotPage("top", at, 1, 1)
+	if total != 2 || len(news) != 1 || news[0].ID != 3 || news[0].Rank != 3 {
+		t.Errorf("second page = %+v of %d, want news 3 ranked 3rd", news, total)
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	openTemp(t)
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	snapshotAt(t, "top", day.Add(9*time.Hour), News{ID: 1, Title: "Morning"})
+	snapshotAt(t, "top", day.Add(21*time.Hour), News{ID: 2, Title: "Evening"})
+	snapshotAt(t, "top", day.Add(30*time.Hour), News{ID: 3, Title: "Next day"})
+
+	PruneSnapshots(day.Add(27 * time.Hour))
+
+	if !HasFront("2026-10-01") {
+		t.Fatal("the front page of the pruned day was not kept")
+	}
+	if front := ReadFront("2026-10-01"); len(front) != 1 || front[0].Title != "Evening" {
+		t.Errorf("ReadFront = %+v, want the last snapshot of the day", front)
+	}
+	if HasFront("2026-10-02") {
+		t.Error("the front page of a day not over before the cutoff was saved")
+	}
+	if taken, _ := ReadSnapshot("top", day.Add(22*time.Hour)); !taken.IsZero() {
+		t.Errorf("the snapshot taken %v is still there, want it pruned", taken)
+	}
+	if taken, news := ReadSnapshot("top", day.Add(31*time.Hour)); !taken.Equal(day.Add(30*time.Hour)) || len(news) != 1 {
+		t.Errorf("ReadSnapshot after the cutoff = %v, %+v, want it kept", taken, news)
+	}
+}
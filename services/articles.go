@@ -0,0 +1,74 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Article is the main content of the page a News links to, for offline reading.
+type Article struct {
+	NewsID      int32     `json:"newsid"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Byline      string    `json:"byline,omitempty"`
+	HTML        string    `json:"html"` // Sanitized HTML of the content
+	Text        string    `json:"text"` // Plain text of the content, paragraphs separated by blank lines
+	Words       int       `json:"words"`
+	ReadingTime int       `json:"reading_time"` // Estimated minutes to read
+	Truncated   bool      `json:"truncated"`    // True if the content was cut to fit MaxArticleBytes
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// MaxArticleBytes is the most HTML and text stored for one Article
+const MaxArticleBytes = 256 << 10
+
+// ErrArticleTooLarge is returned when saving an Article over MaxArticleBytes
+var ErrArticleTooLarge = errors.New("article too large")
+
+// There is a only one single database for all the articles
+var (
+	Articlesdb = newDB("articles-global")
+)
+
+var articlesBucket = []byte("articles")
+
+// SaveArticle stores the Article of the News it was extracted for.
+func SaveArticle(article Article) error {
+	if len(article.HTML)+len(article.Text) > MaxArticleBytes {
+		return ErrArticleTooLarge
+	}
+	v, err := json.Marshal(article)
+	if err != nil {
+		log.Println("SaveArticle:", err)
+		return err
+	}
+	return Articlesdb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(articlesBucket)
+		if err != nil {
+			log.Println("SaveArticle:", err)
+			return err
+		}
+		return b.Put([]byte(strconv.Itoa(int(article.NewsID))), v)
+	})
+}
+
+// ReadArticle returns the Article extracted for the News with the given id.
+func ReadArticle(newsid int) (Article, bool) {
+	var article Article
+	found := false
+	Articlesdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(articlesBucket)
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(strconv.Itoa(newsid)))
+		found = v != nil && json.Unmarshal(v, &article) == nil
+		return nil
+	})
+	return article, found
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Bookmark is a story saved by a user together with a copy of its News, so
+// that it can be shown after it has dropped out of the lists.
+type Bookmark struct {
+	ID      int32     `json:"id"` // Id of the News
+	Tags    []string  `json:"tags"`
+	Note    string    `json:"note"`
+	SavedAt time.Time `json:"saved_at"`
+	News    News      `json:"news"`
+}
+
+// There is a only one single database for the bookmarks of all the users
+var (
+	Bookmarksdb = newDB("bookmarks-global")
+)
+
+// SaveBookmark stores the Bookmark of the user, replacing any Bookmark of the same News.
+func SaveBookmark(username string, bookmark Bookmark) error {
+	v, err := json.Marshal(bookmark)
+	if err != nil {
+		return err
+	}
+	return Bookmarksdb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(username))
+		if err != nil {
+			log.Println("SaveBookmark:", err)
+			return err
+		}
+		return b.Put(bookmarkKey(bookmark.ID), v)
+	})
+}
+
+// ReadBookmark returns the Bookmark of the user of the News with the given id.
+func ReadBookmark(username string, newsid int) (Bookmark, bool) {
+	var bookmark Bookmark
+	found := false
+	Bookmarksdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(username))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get(bookmarkKey(int32(newsid))); v != nil {
+			found = json.Unmarshal(v, &bookmark) == nil
+		}
+		return nil
+	})
+	return bookmark, found
+}
+
+// ReadBookmarks returns the Bookmarks of the user, latest saved first. Only
+// the Bookmarks with the tag are returned unless it is empty.
+func ReadBookmarks(username string, tag string) []Bookmark {
+	bookmarks := []Bookmark{}
+	Bookmarksdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(username))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k []byte, v []byte) error {
+			var bookmark Bookmark
+			if json.Unmarshal(v, &bookmark) != nil {
+				return nil
+			}
+			if tag == "" || hasTag(bookmark, tag) {
+				bookmarks = append(bookmarks, bookmark)
+			}
+			return nil
+		})
+	})
+	sort.Sort(bySavedAt(bookmarks))
+	return bookmarks
+}
+
+// DeleteBookmark deletes the Bookmark of the user of the News with the given
+// id and returns false if there was none.
+func DeleteBookmark(username string, newsid int) bool {
+	found := false
+	Bookmarksdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(username))
+		if b == nil || b.Get(bookmarkKey(int32(newsid))) == nil {
+			return nil
+		}
+		found = true
+		return b.Delete(bookmarkKey(int32(newsid)))
+	})
+	return found
+}
+
+// RefreshBookmarks updates the copies of the News stored in the Bookmarks of
+// every user with the freshly scraped News.
+func RefreshBookmarks(news []News) {
+	byID := make(map[int32]News, len(news))
+	for _, aNews := range news {
+		byID[aNews.ID] = aNews
+	}
+	Bookmarksdb.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			updated := make(map[string][]byte)
+			b.ForEach(func(k []byte, v []byte) error {
+				aNews, ok := byID[int32(binary.BigEndian.Uint32(k))]
+				if !ok {
+					return nil
+				}
+				var bookmark Bookmark
+				if json.Unmarshal(v, &bookmark) != nil {
+					return nil
+				}
+				bookmark.News = BookmarkedNews(aNews)
+				if v, err := json.Marshal(bookmark); err == nil {
+					updated[string(k)] = v
+				}
+				return nil
+			})
+			for k, v := range updated {
+				if err := b.Put([]byte(k), v); err != nil {
+					log.Println("RefreshBookmarks:", err)
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// BookmarkedNews returns the copy of the News stored in a Bookmark, without
+// the rank on the list it was scraped from.
+func BookmarkedNews(news News) News {
+	news.Rank = 0
+	news.PrevRank = 0
+	news.RankDelta = 0
+	news.Preview = nil
+	return news
+}
+
+func hasTag(bookmark Bookmark, tag string) bool {
+	for _, t := range bookmark.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func bookmarkKey(newsid int32) []byte {
+	k := make([]byte, 4)
+	binary.BigEndian.PutUint32(k, uint32(newsid))
+	return k
+}
+
+// Sorts Bookmarks by the time they were saved, latest first
+type bySavedAt []Bookmark
+
+func (bookmarks bySavedAt) Len() int      { return len(bookmarks) }
+func (bookmarks bySavedAt) Swap(i, j int) { bookmarks[i], bookmarks[j] = bookmarks[j], bookmarks[i] }
+func (bookmarks bySavedAt) Less(i, j int) bool {
+	return bookmarks[i].SavedAt.After(bookmarks[j].SavedAt)
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Returns the ids of the Bookmarks in order
+func bookmarkIDs(bookmarks []Bookmark) []int32 {
+	ids := []int32{}
+	for _, bookmark := range bookmarks {
+		ids = append(ids, bookmark.ID)
+	}
+	return ids
+}
+
+func TestBookmarks(t *testing.T) {
+	openTemp(t)
+	now := time.Now()
+	SaveBookmark("alice", Bookmark{ID: 1, Tags: []string{"go"}, SavedAt: now.Add(-2 * time.Hour), News: News{ID: 1, Title: "A"}})
+	SaveBookmark("alice", Bookmark{ID: 2, SavedAt: now.Add(-time.Hour), News: News{ID: 2, Title: "B"}})
+	SaveBookmark("alice", Bookmark{ID: 3, Tags: []string{"go", "db"}, SavedAt: now, News: News{ID: 3, Title: "C"}})
+	SaveBookmark("bob", Bookmark{ID: 4, Tags: []string{"go"}, SavedAt: now})
+
+	tests := []struct {
+		username string
+		tag      string
+		want     []int32
+	}{
+		{"alice", "", []int32{3, 2, 1}},
+		{"alice", "go", []int32{3, 1}},
+		{"alice", "db", []int32{3}},
+		{"alice", "rust", []int32{}},
+		{"carol", "", []int32{}},
+	}
+	for _, test := range tests {
+		if got := bookmarkIDs(ReadBookmarks(test.username, test.tag)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ReadBookmarks(%q, %q) = %v, want %v", test.username, test.tag, got, test.want)
+		}
+	}
+
+	// Saving the same story again replaces its Bookmark
+	SaveBookmark("alice", Bookmark{ID: 1, Note: "Read later", SavedAt: now.Add(-2 * time.Hour), News: News{ID: 1, Title: "A"}})
+	if bookmark, ok := ReadBookmark("alice", 1); !ok || bookmark.Note != "Read later" || len(bookmark.Tags) != 0 {
+		t.Errorf("ReadBookmark after replacing = %+v, %v", bookmark, ok)
+	}
+	if _, ok := ReadBookmark("bob", 1); ok {
+		t.Error("ReadBookmark found the Bookmark of another user")
+	}
+
+	if !DeleteBookmark("alice", 2) {
+		t.Error("DeleteBookmark = false, want true")
+	}
+	if DeleteBookmark("alice", 2) || DeleteBookmark("carol", 1) {
+		t.Error("DeleteBookmark of a missing Bookmark = true, want false")
+	}
+	if got := bookmarkIDs(ReadBookmarks("alice", "")); !reflect.DeepEqual(got, []int32{3, 1}) {
+		t.Errorf("ReadBookmarks after deleting = %v, want 3 and 1", got)
+	}
+}
+
+func TestRefreshBookmarks(t *testing.T) {
+	openTemp(t)
+	SaveBookmark("alice", Bookmark{ID: 1, News: News{ID: 1, Title: "A", Points: 10}})
+	SaveBookmark("bob", Bookmark{ID: 1, News: News{ID: 1, Title: "A", Points: 10}})
+	SaveBookmark("bob", Bookmark{ID: 2, News: News{ID: 2, Title: "B", Points: 5}})
+
+	// Story 2 left the lists, its Bookmark keeps the stored copy
+	RefreshBookmarks([]News{{ID: 1, Title: "A", Points: 42, Rank: 3, PrevRank: 5, RankDelta: 2}, {ID: 9, Title: "C"}})
+	for _, username := range []string{"alice", "bob"} {
+		bookmark, _ := ReadBookmark(username, 1)
+		if bookmark.News.Points != 42 || bookmark.News.Rank != 0 || bookmark.News.PrevRank != 0 || bookmark.News.RankDelta != 0 {
+			t.Errorf("refreshed News of %s = %+v, want 42 points without a rank", username, bookmark.News)
+		}
+	}
+	if bookmark, _ := ReadBookmark("bob", 2); bookmark.News.Points != 5 {
+		t.Errorf("News of a story off the lists = %+v, want the stored copy", bookmark.News)
+	}
+	if _, ok := ReadBookmark("alice", 9); ok {
+		t.Error("RefreshBookmarks bookmarked a story")
+	}
+}
+
+func TestLatestNews(t *testing.T) {
+	openTemp(t)
+	now := time.Now()
+	appendAt(t, "top", now.Add(-time.Hour), News{ID: 1, Title: "A", Points: 10, Rank: 1})
+	appendAt(t, "top", now, News{ID: 1, Title: "A", Points: 20, Rank: 2})
+
+	if news, ok := LatestNews(1); !ok || news.Points != 20 {
+		t.Errorf("LatestNews = %+v, %v, want the latest sample", news, ok)
+	}
+	// Never seen on a list, the API fetches it from Hacker News instead
+	if _, ok := LatestNews(2); ok {
+		t.Error("LatestNews of a story never seen = true, want false")
+	}
+}
@@ -0,0 +1,424 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Sample is one observation of a News item made during a scrape.
+type Sample struct {
+	Time     time.Time `json:"time"`
+	Points   int32     `json:"points"`
+	Comments int32     `json:"comments"`
+	List     string    `json:"list,omitempty"`  // Name of the list the News was ranked on, empty when scraped off-list
+	Rank     int32     `json:"rank,omitempty"`  // Rank on List, 0 when scraped off-list
+	Title    string    `json:"title,omitempty"` // Only set when the title changed since the previous Sample
+}
+
+// There is a only one single database for the history of all the News
+var (
+	Historydb = newDB("history-global")
+)
+
+// Each News gets a bucket named after its id with the following keys.
+var (
+	historyNewsKey    = []byte("news")    // Latest News seen as JSON
+	historySeenKey    = []byte("seen")    // Last time the News was seen on a list
+	historySamplesKey = []byte("samples") // Nested bucket of Samples keyed by time
+)
+
+// Every Sample is also indexed in this bucket by time and id of the News so
+// that the recent Samples are found without going through every News.
+var historyIndexKey = []byte("index?time")
+
+// AppendSamples appends a Sample for every News ranked on the list.
+func AppendSamples(list string, news []News) {
+	now := time.Now()
+	Historydb.Update(func(tx *bolt.Tx) error {
+		for _, aNews := range news {
+			if aNews.ID == 0 {
+				continue
+			}
+			if err := appendSample(tx, list, aNews, now); err != nil {
+				log.Println("AppendSamples:", err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TrackSample appends a Sample for a News scraped from its item page after
+// it left the lists.
+func TrackSample(news News) {
+	Historydb.Update(func(tx *bolt.Tx) error {
+		if err := appendSample(tx, "", news, time.Now()); err != nil {
+			log.Println("TrackSample:", err)
+			return err
+		}
+		return nil
+	})
+}
+
+func appendSample(tx *bolt.Tx, list string, news News, now time.Time) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(strconv.Itoa(int(news.ID))))
+	if err != nil {
+		return err
+	}
+	samples, err := b.CreateBucketIfNotExists(historySamplesKey)
+	if err != nil {
+		return err
+	}
+
+	sample := Sample{Time: now, Points: news.Points, Comments: news.Comments, List: list, Rank: news.Rank}
+	var previous News
+	if v := b.Get(historyNewsKey); v == nil || json.Unmarshal(v, &previous) != nil || previous.Title != news.Title {
+		sample.Title = news.Title
+	}
+
+	// Keep the original rank and time around when scraped off-list since the item page has neither
+	if list == "" {
+		news.Rank = previous.Rank
+		if news.Time.IsZero() {
+			news.Time = previous.Time
+		}
+	}
+	v, err := json.Marshal(news)
+	if err != nil {
+		return err
+	}
+	b.Put(historyNewsKey, v)
+
+	if list != "" {
+		var t bytes.Buffer
+		binary.Write(&t, binary.LittleEndian, now.Unix())
+		b.Put(historySeenKey, t.Bytes())
+	}
+
+	// A News may be sampled more than once at the same time, e.g. when it is twice on a page
+	seq, err := samples.NextSequence()
+	if err != nil {
+		return err
+	}
+	if err := samples.Put(sequenceKey(now, seq), encodeSample(sample)); err != nil {
+		return err
+	}
+	index, err := historyIndex(tx)
+	if err != nil {
+		return err
+	}
+	return index.Put(indexKey(now, news.ID), nil)
+}
+
+// Returns the index of the Samples, indexing the Samples taken before there
+// was one the first time.
+func historyIndex(tx *bolt.Tx) (*bolt.Bucket, error) {
+	if index := tx.Bucket(historyIndexKey); index != nil {
+		return index, nil
+	}
+	index, err := tx.CreateBucket(historyIndexKey)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		id, err := strconv.Atoi(string(name))
+		if err != nil {
+			return nil
+		}
+		samples := b.Bucket(historySamplesKey)
+		if samples == nil {
+			return nil
+		}
+		return samples.ForEach(func(k, v []byte) error {
+			return index.Put(indexKey(sampleTime(k), int32(id)), nil)
+		})
+	})
+	return index, err
+}
+
+// ReadHistory returns the Samples of the News with the given id taken after since.
+func ReadHistory(newsid int, since time.Time) []Sample {
+	var history []Sample
+	Historydb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(strconv.Itoa(newsid)))
+		if b == nil {
+			return nil
+		}
+		samples := b.Bucket(historySamplesKey)
+		if samples == nil {
+			return nil
+		}
+		c := samples.Cursor()
+		for k, v := c.Seek(sampleKey(since)); k != nil; k, v = c.Next() {
+			history = append(history, decodeSample(k, v))
+		}
+		return nil
+	})
+	return history
+}
+
+// LatestNews returns the latest News seen with the given id.
+func LatestNews(newsid int) (News, bool) {
+	var news News
+	found := false
+	Historydb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(strconv.Itoa(newsid)))
+		if b == nil {
+			return nil
+		}
+		found = json.Unmarshal(b.Get(historyNewsKey), &news) == nil
+		return nil
+	})
+	return news, found
+}
+
+// History is the latest News seen for a story together with its Samples.
+type History struct {
+	News    News
+	Samples []Sample
+}
+
+// ReadRecentHistory returns the History of every News sampled after since,
+// only including the Samples taken after since.
+func ReadRecentHistory(since time.Time) []History {
+	var histories []History
+	from := sampleKey(since)
+	Historydb.View(func(tx *bolt.Tx) error {
+		for _, id := range indexedIDs(tx, from, nil) {
+			b := tx.Bucket([]byte(strconv.Itoa(int(id))))
+			if b == nil {
+				continue
+			}
+			samples := b.Bucket(historySamplesKey)
+			if samples == nil {
+				continue
+			}
+
+			var history History
+			if err := json.Unmarshal(b.Get(historyNewsKey), &history.News); err != nil {
+				continue
+			}
+			c := samples.Cursor()
+			for k, v := c.Seek(from); k != nil; k, v = c.Next() {
+				history.Samples = append(history.Samples, decodeSample(k, v))
+			}
+			histories = append(histories, history)
+		}
+		return nil
+	})
+	return histories
+}
+
+// Returns the ids of the News sampled from the key from until the key to,
+// or until the last Sample if to is nil, in the order they were first sampled.
+func indexedIDs(tx *bolt.Tx, from []byte, to []byte) []int32 {
+	var ids []int32
+	index := tx.Bucket(historyIndexKey)
+	if index == nil {
+		return nil
+	}
+	seen := make(map[int32]bool)
+	c := index.Cursor()
+	for k, _ := c.Seek(from); k != nil && (to == nil || bytes.Compare(k, to) < 0); k, _ = c.Next() {
+		id := int32(binary.BigEndian.Uint32(k[8:]))
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// PruneHistory deletes the Samples taken before, along with the News that
+// have no Samples left and have not been seen on a list since.
+func PruneHistory(before time.Time) {
+	to := sampleKey(before)
+	Historydb.Update(func(tx *bolt.Tx) error {
+		index, err := historyIndex(tx)
+		if err != nil {
+			log.Println("PruneHistory:", err)
+			return err
+		}
+		for _, id := range indexedIDs(tx, nil, to) {
+			name := []byte(strconv.Itoa(int(id)))
+			b := tx.Bucket(name)
+			if b == nil {
+				continue
+			}
+			if samples := b.Bucket(historySamplesKey); samples != nil {
+				if err := deleteBefore(samples, to); err != nil {
+					log.Println("PruneHistory:", err)
+					return err
+				}
+				if k, _ := samples.Cursor().First(); k != nil {
+					continue
+				}
+			}
+			var seen int64
+			binary.Read(bytes.NewReader(b.Get(historySeenKey)), binary.LittleEndian, &seen)
+			if time.Unix(seen, 0).Before(before) {
+				if err := tx.DeleteBucket(name); err != nil {
+					log.Println("PruneHistory:", err)
+					return err
+				}
+			}
+		}
+		if err := deleteBefore(index, to); err != nil {
+			log.Println("PruneHistory:", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// Deletes the keys of b that sort before the key to
+func deleteBefore(b *bolt.Bucket, to []byte) error {
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, to) < 0; k, _ = c.First() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OffListIDs returns the ids of the News that has not been seen on any list
+// for stale but were seen within period.
+func OffListIDs(stale time.Duration, period time.Duration) []int32 {
+	var ids []int32
+	now := time.Now()
+	Historydb.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			var seen int64
+			binary.Read(bytes.NewReader(b.Get(historySeenKey)), binary.LittleEndian, &seen)
+			age := now.Sub(time.Unix(seen, 0))
+			if age < stale || age > period {
+				return nil
+			}
+			id, err := strconv.Atoi(string(name))
+			if err != nil {
+				return nil
+			}
+			ids = append(ids, int32(id))
+			return nil
+		})
+	})
+	return ids
+}
+
+// Sets PrevRank and RankDelta on the News ranked on the list from their History.
+func annotateRanks(list string, news []News) {
+	Historydb.View(func(tx *bolt.Tx) error {
+		for i := range news {
+			prev := previousRank(tx, list, news[i].ID)
+			news[i].PrevRank = prev
+			if prev != 0 {
+				news[i].RankDelta = prev - news[i].Rank
+			}
+		}
+		return nil
+	})
+}
+
+// Walks back at most this many Samples looking for the previous rank on a list.
+const maxRankLookback = 32
+
+// Returns the rank of the News in the second latest Sample on the list, or 0.
+func previousRank(tx *bolt.Tx, list string, newsid int32) int32 {
+	b := tx.Bucket([]byte(strconv.Itoa(int(newsid))))
+	if b == nil {
+		return 0
+	}
+	samples := b.Bucket(historySamplesKey)
+	if samples == nil {
+		return 0
+	}
+	c := samples.Cursor()
+	found := 0
+	k, v := c.Last()
+	for i := 0; k != nil && i < maxRankLookback; i++ {
+		sample := decodeSample(k, v)
+		if sample.List == list {
+			found++
+			if found == 2 {
+				return sample.Rank
+			}
+		}
+		k, v = c.Prev()
+	}
+	return 0
+}
+
+// Samples are keyed by big endian unix nanoseconds so that they sort by time.
+func sampleKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return k
+}
+
+// Samples taken at the same time are told apart by a sequence after the time.
+func sequenceKey(t time.Time, seq uint64) []byte {
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(k[8:], seq)
+	return k
+}
+
+// The index is keyed by time followed by the big endian id of the News.
+func indexKey(t time.Time, newsid int32) []byte {
+	k := make([]byte, 12)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint32(k[8:], uint32(newsid))
+	return k
+}
+
+// Returns the time of the key of a Sample or a snapshot.
+func sampleTime(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+}
+
+// Positions c on the last key of a time no later than t, if any.
+func seekAtOrBefore(c *bolt.Cursor, t time.Time) ([]byte, []byte) {
+	if k, _ := c.Seek(sampleKey(t.Add(time.Nanosecond))); k == nil {
+		return c.Last()
+	}
+	return c.Prev()
+}
+
+// Samples are stored as points, comments, rank, length of list, list and title.
+func encodeSample(sample Sample) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, sample.Points)
+	binary.Write(&buf, binary.LittleEndian, sample.Comments)
+	binary.Write(&buf, binary.LittleEndian, sample.Rank)
+	buf.WriteByte(byte(len(sample.List)))
+	buf.WriteString(sample.List)
+	buf.WriteString(sample.Title)
+	return buf.Bytes()
+}
+
+func decodeSample(k []byte, v []byte) Sample {
+	var sample Sample
+	sample.Time = sampleTime(k)
+	r := bytes.NewReader(v)
+	binary.Read(r, binary.LittleEndian, &sample.Points)
+	binary.Read(r, binary.LittleEndian, &sample.Comments)
+	binary.Read(r, binary.LittleEndian, &sample.Rank)
+	n, err := r.ReadByte()
+	if err != nil {
+		return sample
+	}
+	rest := v[len(v)-r.Len():]
+	if int(n) > len(rest) {
+		return sample
+	}
+	sample.List = string(rest[:n])
+	sample.Title = string(rest[n:])
+	return sample
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Opens the global databases in a directory removed after the test
+func openTemp(t *testing.T) {
+	if err := Open(t.TempDir()); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(Close)
+}
+
+// Appends the Samples of the News on the list as if taken at the given time
+func appendAt(t *testing.T, list string, at time.Time, news ...News) {
+	err := Historydb.Update(func(tx *bolt.Tx) error {
+		for _, aNews := range news {
+			if err := appendSample(tx, list, aNews, at); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("appendSample: %v", err)
+	}
+}
+
+func TestSamplesAtTheSameTime(t *testing.T) {
+	openTemp(t)
+	now := time.Now()
+	appendAt(t, "top", now, News{ID: 1, Title: "A", Points: 10, Rank: 1}, News{ID: 1, Title: "A", Points: 11, Rank: 2})
+
+	history := ReadHistory(1, now.Add(-time.Minute))
+	if len(history) != 2 {
+		t.Fatalf("ReadHistory = %+v, want both samples", history)
+	}
+	if history[0].Points != 10 || history[1].Points != 11 || !history[1].Time.Equal(now) {
+		t.Errorf("ReadHistory = %+v, want the samples in order", history)
+	}
+}
+
+func TestReadRecentHistory(t *testing.T) {
+	openTemp(t)
+	now := time.Now()
+	appendAt(t, "top", now.Add(-3*time.Hour), News{ID: 1, Title: "Old"}, News{ID: 2, Title: "Both"})
+	appendAt(t, "top", now.Add(-time.Hour), News{ID: 2, Title: "Both", Points: 5}, News{ID: 3, Title: "New"})
+
+	histories := ReadRecentHistory(now.Add(-2 * time.Hour))
+	if len(histories) != 2 {
+		t.Fatalf("ReadRecentHistory = %+v, want news 2 and 3", histories)
+	}
+	for i, id := range []int32{2, 3} {
+		if histories[i].News.ID != id || len(histories[i].Samples) != 1 {
+			t.Errorf("histories[%d] = %+v, want news %d with one sample", i, histories[i], id)
+		}
+	}
+	if histories[0].Samples[0].Points != 5 {
+		t.Errorf("sample of news 2 = %+v, want the recent one", histories[0].Samples[0])
+	}
+}
+
+func TestIndexExistingSamples(t *testing.T) {
+	openTemp(t)
+	now := time.Now()
+	// Samples taken before there was an index
+	err := Historydb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("7"))
+		if err != nil {
+			return err
+		}
+		b.Put(historyNewsKey, []byte(`{"id":7,"title":"Before"}`))
+		samples, err := b.CreateBucket(historySamplesKey)
+		if err != nil {
+			return err
+		}
+		return samples.Put(sampleKey(now.Add(-time.Hour)), encodeSample(Sample{Points: 3}))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendAt(t, "top", now, News{ID: 8, Title: "After"})
+
+	histories := ReadRecentHistory(now.Add(-2 * time.Hour))
+	if len(histories) != 2 || histories[0].News.ID != 7 || histories[0].Samples[0].Points != 3 {
+		t.Errorf("ReadRecentHistory = %+v, want news 7 then 8", histories)
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	openTemp(t)
+	now := time.Now()
+	appendAt(t, "top", now.Add(-48*time.Hour), News{ID: 1, Title: "Gone"}, News{ID: 2, Title: "Kept"})
+	appendAt(t, "", now.Add(-time.Hour), News{ID: 2, Title: "Kept", Points: 9})
+
+	PruneHistory(now.Add(-24 * time.Hour))
+
+	if _, ok := LatestNews(1); ok {
+		t.Error("news 1 is still there, want it pruned")
+	}
+	if _, ok := LatestNews(2); !ok {
+		t.Error("news 2 was pruned, want it kept since it was sampled since")
+	}
+	history := ReadHistory(2, time.Unix(0, 0))
+	if len(history) != 1 || history[0].Points != 9 {
+		t.Errorf("ReadHistory(2) = %+v, want only the recent sample", history)
+	}
+	if histories := ReadRecentHistory(time.Unix(0, 0)); len(histories) != 1 {
+		t.Errorf("ReadRecentHistory = %+v, want the index pruned too", histories)
+	}
+}
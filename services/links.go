@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// LinkMeta is the OpenGraph/Twitter card metadata of the page a News links to.
+type LinkMeta struct {
+	URL         string    `json:"url"` // Canonical URL of the page
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	SiteName    string    `json:"site_name,omitempty"`
+	Favicon     string    `json:"favicon,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// There is a only one single database for the metadata of all the links
+var (
+	Linksdb = newDB("links-global")
+)
+
+var linksBucket = []byte("meta")
+
+// SaveLinkMeta stores the metadata of the link of the News with the given id.
+func SaveLinkMeta(newsid int32, meta LinkMeta) {
+	v, err := json.Marshal(meta)
+	if err != nil {
+		log.Println("SaveLinkMeta:", err)
+		return
+	}
+	Linksdb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(linksBucket)
+		if err != nil {
+			log.Println("SaveLinkMeta:", err)
+			return err
+		}
+		return b.Put([]byte(strconv.Itoa(int(newsid))), v)
+	})
+}
+
+// ReadLinkMeta returns the metadata of the link of the News with the given id.
+func ReadLinkMeta(newsid int32) (LinkMeta, bool) {
+	var meta LinkMeta
+	found := false
+	Linksdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(linksBucket)
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(strconv.Itoa(int(newsid))))
+		found = v != nil && json.Unmarshal(v, &meta) == nil
+		return nil
+	})
+	return meta, found
+}
+
+// Sets the Preview of the News that has been enriched.
+func annotateLinks(news []News) {
+	Linksdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(linksBucket)
+		if b == nil {
+			return nil
+		}
+		for i := range news {
+			v := b.Get([]byte(strconv.Itoa(int(news[i].ID))))
+			if v == nil {
+				continue
+			}
+			var meta LinkMeta
+			if json.Unmarshal(v, &meta) == nil {
+				news[i].Preview = &meta
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Notification is a direct reply to a comment or story of a user.
+type Notification struct {
+	ID     int32     `json:"id"`     // Id of the reply
+	Parent int32     `json:"parent"` // Id of the comment or story replied to
+	Story  int32     `json:"story"`  // Id of the story of the thread, 0 if unknown
+	Author string    `json:"author"`
+	Text   string    `json:"text"`
+	Time   time.Time `json:"time"`
+	Read   bool      `json:"read"`
+}
+
+// There is a only one single database for the notifications of all the users
+var (
+	Notificationsdb = newDB("notifications-global")
+)
+
+// Each user gets a bucket named after the username with the following keys.
+var (
+	notificationsCheckedKey = []byte("checked") // Last time the replies of the user were checked
+	notificationsItemsKey   = []byte("items")   // Nested bucket of Notifications keyed by id
+)
+
+// SaveNotifications stores the replies not seen before as unread and returns
+// how many there were. The first time a user is checked all the replies are
+// stored as read, they are not new to the user.
+func SaveNotifications(username string, notifications []Notification) int {
+	added := 0
+	Notificationsdb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(username))
+		if err != nil {
+			log.Println("SaveNotifications:", err)
+			return err
+		}
+		items, err := b.CreateBucketIfNotExists(notificationsItemsKey)
+		if err != nil {
+			log.Println("SaveNotifications:", err)
+			return err
+		}
+		first := b.Get(notificationsCheckedKey) == nil
+
+		for _, notification := range notifications {
+			k := notificationKey(notification.ID)
+			if notification.ID == 0 || items.Get(k) != nil {
+				continue
+			}
+			notification.Read = first
+			v, err := json.Marshal(notification)
+			if err != nil {
+				log.Println("SaveNotifications:", err)
+				continue
+			}
+			items.Put(k, v)
+			if !first {
+				added++
+			}
+		}
+
+		checked := make([]byte, 8)
+		binary.LittleEndian.PutUint64(checked, uint64(time.Now().Unix()))
+		return b.Put(notificationsCheckedKey, checked)
+	})
+	return added
+}
+
+// ReadNotifications returns the Notifications of the user, newest first, and
+// the number of unread ones. Only the unread are returned if unreadOnly.
+func ReadNotifications(username string, unreadOnly bool) ([]Notification, int) {
+	notifications := []Notification{}
+	unread := 0
+	Notificationsdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(username))
+		if b == nil {
+			return nil
+		}
+		items := b.Bucket(notificationsItemsKey)
+		if items == nil {
+			return nil
+		}
+		c := items.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var notification Notification
+			if json.Unmarshal(v, &notification) != nil {
+				continue
+			}
+			if !notification.Read {
+				unread++
+			} else if unreadOnly {
+				continue
+			}
+			notifications = append(notifications, notification)
+		}
+		return nil
+	})
+	return notifications, unread
+}
+
+// MarkNotificationsRead marks the Notifications of the user with the given
+// ids as read, or all of them if no ids are given.
+func MarkNotificationsRead(username string, ids []int32) {
+	Notificationsdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(username))
+		if b == nil {
+			return nil
+		}
+		items := b.Bucket(notificationsItemsKey)
+		if items == nil {
+			return nil
+		}
+		var keys [][]byte
+		if len(ids) == 0 {
+			items.ForEach(func(k []byte, v []byte) error {
+				keys = append(keys, append([]byte(nil), k...))
+				return nil
+			})
+		}
+		for _, id := range ids {
+			keys = append(keys, notificationKey(id))
+		}
+
+		for _, k := range keys {
+			var notification Notification
+			if v := items.Get(k); v == nil || json.Unmarshal(v, &notification) != nil || notification.Read {
+				continue
+			}
+			notification.Read = true
+			v, err := json.Marshal(notification)
+			if err != nil {
+				log.Println("MarkNotificationsRead:", err)
+				continue
+			}
+			items.Put(k, v)
+		}
+		return nil
+	})
+}
+
+// Notifications are keyed by big endian id so that they sort by age
+func notificationKey(id int32) []byte {
+	k := make([]byte, 4)
+	binary.BigEndian.PutUint32(k, uint32(id))
+	return k
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Returns the ids of the Notifications in order
+func notificationIDs(notifications []Notification) []int32 {
+	ids := []int32{}
+	for _, notification := range notifications {
+		ids = append(ids, notification.ID)
+	}
+	return ids
+}
+
+func TestSaveNotifications(t *testing.T) {
+	openTemp(t)
+	checks := []struct {
+		replies    []int32 // Ids of the replies found by a check
+		wantAdded  int
+		wantUnread []int32
+	}{
+		// The replies found the first time are not new to the user
+		{[]int32{1, 2}, 0, []int32{}},
+		{[]int32{1, 2, 3}, 1, []int32{3}},
+		// Replies seen before are not added again, even once off the page
+		{[]int32{3, 4, 0}, 1, []int32{4, 3}},
+		{nil, 0, []int32{4, 3}},
+	}
+	for i, check := range checks {
+		var notifications []Notification
+		for _, id := range check.replies {
+			notifications = append(notifications, Notification{ID: id, Parent: 100, Author: "bob"})
+		}
+		if added := SaveNotifications("alice", notifications); added != check.wantAdded {
+			t.Errorf("check %d: SaveNotifications = %d, want %d", i, added, check.wantAdded)
+		}
+		unread, count := ReadNotifications("alice", true)
+		if got := notificationIDs(unread); !reflect.DeepEqual(got, check.wantUnread) || count != len(check.wantUnread) {
+			t.Errorf("check %d: unread = %v (%d), want %v", i, got, count, check.wantUnread)
+		}
+	}
+
+	all, _ := ReadNotifications("alice", false)
+	if got := notificationIDs(all); !reflect.DeepEqual(got, []int32{4, 3, 2, 1}) {
+		t.Errorf("ReadNotifications = %v, want newest first", got)
+	}
+	if others, _ := ReadNotifications("bob", false); len(others) != 0 {
+		t.Errorf("ReadNotifications of another user = %v, want none", others)
+	}
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	openTemp(t)
+	SaveNotifications("alice", nil)
+	SaveNotifications("alice", []Notification{{ID: 1}, {ID: 2}, {ID: 3}})
+
+	MarkNotificationsRead("alice", []int32{2, 9})
+	if unread, count := ReadNotifications("alice", true); !reflect.DeepEqual(notificationIDs(unread), []int32{3, 1}) || count != 2 {
+		t.Errorf("unread after marking 2 = %v (%d), want 3 and 1", notificationIDs(unread), count)
+	}
+	MarkNotificationsRead("alice", nil)
+	if _, count := ReadNotifications("alice", true); count != 0 {
+		t.Errorf("unread after marking all = %d, want 0", count)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// ErrNotOpen is returned when a database is used before it is opened
+var ErrNotOpen = errors.New("services: database not open")
+
+// DB is a Bolt database stored in a file in the data directory. It can be
+// replaced while in use by a newer copy of itself published by another
+// process, see Replace.
+type DB struct {
+	File string // Name of the file in the data directory
+
+	current atomic.Value // *bolt.DB
+}
+
+func newDB(file string) *DB {
+	db := new(DB)
+	db.File = file
+	db.current.Store((*bolt.DB)(nil))
+	return db
+}
+
+// Bolt returns the open Bolt database, nil if it is not open.
+func (db *DB) Bolt() *bolt.DB {
+	return db.current.Load().(*bolt.DB)
+}
+
+// View runs fn in a read-only transaction, like bolt.DB.View.
+func (db *DB) View(fn func(*bolt.Tx) error) error {
+	b := db.Bolt()
+	if b == nil {
+		return ErrNotOpen
+	}
+	return b.View(fn)
+}
+
+// Update runs fn in a read-write transaction, like bolt.DB.Update.
+func (db *DB) Update(fn func(*bolt.Tx) error) error {
+	b := db.Bolt()
+	if b == nil {
+		return ErrNotOpen
+	}
+	return b.Update(fn)
+}
+
+// Replace makes b the database and returns the one it replaced, which the
+// caller closes once it no longer is in use.
+func (db *DB) Replace(b *bolt.DB) *bolt.DB {
+	old := db.Bolt()
+	db.current.Store(b)
+	return old
+}
+
+// Close closes the database.
+func (db *DB) Close() error {
+	if b := db.Replace(nil); b != nil {
+		return b.Close()
+	}
+	return nil
+}
+
+// Directory all the databases are stored in, set by Open
+var dataDir = "."
+
+// The databases of what is scraped from Hacker News, written by the scrapers
+var scrapedDBs = []*DB{Commentsdb, Historydb, Archivedb, Linksdb, Articlesdb}
+
+// The databases of what the logged in users do, written by the API
+var userDBs = []*DB{Notificationsdb, Outboxdb, Bookmarksdb, Readdb}
+
+// ScrapedDBs returns the global databases written by the scrapers.
+func ScrapedDBs() []*DB {
+	return scrapedDBs
+}
+
+// Open opens all the global databases in dir, call before using anything else
+// in services. Fails instead of waiting if another process has a database open.
+func Open(dir string) error {
+	if err := OpenScraped(dir); err != nil {
+		return err
+	}
+	return OpenUsers(dir)
+}
+
+// OpenScraped opens the global databases written by the scrapers in dir.
+func OpenScraped(dir string) error {
+	return openAll(dir, scrapedDBs, false)
+}
+
+// OpenScrapedReadOnly opens the global databases written by the scrapers in
+// dir read-only, e.g. to export what was scraped.
+func OpenScrapedReadOnly(dir string) error {
+	return openAll(dir, scrapedDBs, true)
+}
+
+// OpenUsers opens the global databases written on behalf of the users in dir.
+func OpenUsers(dir string) error {
+	return openAll(dir, userDBs, false)
+}
+
+func openAll(dir string, dbs []*DB, readOnly bool) error {
+	dataDir = dir
+	for _, db := range dbs {
+		b, err := OpenBolt(dataPath(db.File), readOnly)
+		if err != nil {
+			Close()
+			return err
+		}
+		db.Replace(b)
+	}
+	return nil
+}
+
+// Returns the path of the file in the data directory
+func dataPath(file string) string {
+	return filepath.Join(dataDir, file)
+}
+
+// Close closes all the global databases.
+func Close() {
+	for _, db := range scrapedDBs {
+		db.Close()
+	}
+	for _, db := range userDBs {
+		db.Close()
+	}
+}
+
+// OpenBolt opens the Bolt database at path, failing instead of waiting if
+// another process has it open for writing.
+func OpenBolt(path string, readOnly bool) (*bolt.DB, error) {
+	b, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("services: could not open %s: %v", path, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// The states of an OutboxAction
+const (
+	OutboxPending = "pending" // Waiting to be delivered to Hacker News
+	OutboxFailed  = "failed"  // Given up on, see Error
+	OutboxSent    = "sent"    // Delivered to Hacker News
+)
+
+// ErrNoAction is returned when there is no pending OutboxAction to cancel or
+// save, e.g. because the user canceled it in the meantime
+var ErrNoAction = errors.New("services: no pending action")
+
+// OutboxAction is a write action of a user queued for delivery to Hacker News.
+type OutboxAction struct {
+	ID          uint64    `json:"id"`
+	Username    string    `json:"username"`
+	Kind        string    `json:"kind"`           // upvote, comment, reply or submit
+	Item        int       `json:"item,omitempty"` // Id of the item acted on, not set when submitting
+	Title       string    `json:"title,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Text        string    `json:"text,omitempty"`
+	State       string    `json:"state"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error,omitempty"`  // Error code of the last attempt
+	Result      int       `json:"result,omitempty"` // Id of the submitted story
+	Created     time.Time `json:"created"`
+	NextAttempt time.Time `json:"next_attempt"`
+	Updated     time.Time `json:"updated"`
+}
+
+// There is a only one single database for the queued actions of all the users
+var (
+	Outboxdb = newDB("outbox-global")
+)
+
+// OutboxActions are kept in this bucket keyed by their id
+var outboxKey = []byte("actions")
+
+// QueueAction stores the action as pending, due at its NextAttempt or right
+// away if that is not set, and returns it with its id.
+func QueueAction(action OutboxAction) (OutboxAction, error) {
+	now := time.Now()
+	action.State = OutboxPending
+	action.Created = now
+	if action.NextAttempt.IsZero() {
+		action.NextAttempt = now
+	}
+	action.Updated = now
+	err := Outboxdb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(outboxKey)
+		if err != nil {
+			return err
+		}
+		action.ID, err = b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return putAction(b, action)
+	})
+	if err != nil {
+		log.Println("QueueAction:", err)
+	}
+	return action, err
+}
+
+// SaveAction stores the changed state of an action, as long as the action
+// is still pending. Returns ErrNoAction if it is not.
+func SaveAction(action OutboxAction) error {
+	action.Updated = time.Now()
+	err := Outboxdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(outboxKey)
+		if b == nil || !isPending(b, action.ID) {
+			return ErrNoAction
+		}
+		return putAction(b, action)
+	})
+	if err != nil && err != ErrNoAction {
+		log.Println("SaveAction:", err)
+	}
+	return err
+}
+
+// ActionPending returns true if the action with the given id is still
+// pending, i.e. it was neither delivered, given up on nor canceled.
+func ActionPending(id uint64) bool {
+	pending := false
+	Outboxdb.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(outboxKey); b != nil {
+			pending = isPending(b, id)
+		}
+		return nil
+	})
+	return pending
+}
+
+func isPending(b *bolt.Bucket, id uint64) bool {
+	var action OutboxAction
+	v := b.Get(actionKey(id))
+	return v != nil && json.Unmarshal(v, &action) == nil && action.State == OutboxPending
+}
+
+// ReadOutbox returns the actions of the user, newest first.
+func ReadOutbox(username string) []OutboxAction {
+	actions := []OutboxAction{}
+	Outboxdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(outboxKey)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var action OutboxAction
+			if json.Unmarshal(v, &action) == nil && action.Username == username {
+				actions = append(actions, action)
+			}
+		}
+		return nil
+	})
+	return actions
+}
+
+// DueActions returns the pending actions due at now, oldest first.
+func DueActions(now time.Time) []OutboxAction {
+	var actions []OutboxAction
+	Outboxdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(outboxKey)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k []byte, v []byte) error {
+			var action OutboxAction
+			if json.Unmarshal(v, &action) != nil {
+				return nil
+			}
+			if action.State == OutboxPending && !action.NextAttempt.After(now) {
+				actions = append(actions, action)
+			}
+			return nil
+		})
+	})
+	return actions
+}
+
+// CancelAction deletes the pending action of the user with the given id.
+func CancelAction(username string, id uint64) error {
+	return Outboxdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(outboxKey)
+		if b == nil {
+			return ErrNoAction
+		}
+		var action OutboxAction
+		if v := b.Get(actionKey(id)); v == nil || json.Unmarshal(v, &action) != nil {
+			return ErrNoAction
+		}
+		if action.Username != username || action.State != OutboxPending {
+			return ErrNoAction
+		}
+		return b.Delete(actionKey(id))
+	})
+}
+
+// PurgeOutbox deletes the sent and failed actions last updated before age ago.
+func PurgeOutbox(age time.Duration) {
+	before := time.Now().Add(-age)
+	Outboxdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(outboxKey)
+		if b == nil {
+			return nil
+		}
+		var old [][]byte
+		b.ForEach(func(k []byte, v []byte) error {
+			var action OutboxAction
+			if json.Unmarshal(v, &action) == nil && action.State != OutboxPending && action.Updated.Before(before) {
+				old = append(old, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range old {
+			b.Delete(k)
+		}
+		return nil
+	})
+}
+
+func putAction(b *bolt.Bucket, action OutboxAction) error {
+	v, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+	return b.Put(actionKey(action.ID), v)
+}
+
+// Actions are keyed by big endian id so that they sort by age
+func actionKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaveCanceledAction(t *testing.T) {
+	openTemp(t)
+	action, err := QueueAction(OutboxAction{Username: "alice", Kind: "upvote", Item: 1})
+	if err != nil {
+		t.Fatalf("QueueAction: %v", err)
+	}
+	if !ActionPending(action.ID) {
+		t.Fatal("ActionPending = false right after queueing")
+	}
+
+	// Delivered while the user cancels it
+	if err := CancelAction("alice", action.ID); err != nil {
+		t.Fatalf("CancelAction: %v", err)
+	}
+	action.State = OutboxSent
+	if err := SaveAction(action); err != ErrNoAction {
+		t.Errorf("SaveAction of a canceled action = %v, want %v", err, ErrNoAction)
+	}
+	if outbox := ReadOutbox("alice"); len(outbox) != 0 {
+		t.Errorf("ReadOutbox = %+v, want the cancel to win", outbox)
+	}
+}
+
+func TestSaveDeliveredAction(t *testing.T) {
+	openTemp(t)
+	action, _ := QueueAction(OutboxAction{Username: "alice", Kind: "upvote", Item: 1})
+	action.State = OutboxSent
+	if err := SaveAction(action); err != nil {
+		t.Fatalf("SaveAction: %v", err)
+	}
+	// Only pending actions are saved
+	if err := SaveAction(action); err != ErrNoAction {
+		t.Errorf("second SaveAction = %v, want %v", err, ErrNoAction)
+	}
+	if ActionPending(action.ID) {
+		t.Error("ActionPending = true after it was sent")
+	}
+	if err := CancelAction("alice", action.ID); err != ErrNoAction {
+		t.Errorf("CancelAction of a sent action = %v, want %v", err, ErrNoAction)
+	}
+}
+
+func TestQueueActionDueLater(t *testing.T) {
+	openTemp(t)
+	now := time.Now()
+	later, _ := QueueAction(OutboxAction{Username: "alice", Kind: "upvote", Item: 1, NextAttempt: now.Add(time.Minute)})
+	right, _ := QueueAction(OutboxAction{Username: "alice", Kind: "upvote", Item: 2})
+
+	due := DueActions(now.Add(time.Second))
+	if len(due) != 1 || due[0].ID != right.ID {
+		t.Errorf("DueActions now = %+v, want only the action queued without a NextAttempt", due)
+	}
+	if due := DueActions(now.Add(2 * time.Minute)); len(due) != 2 || due[0].ID != later.ID {
+		t.Errorf("DueActions later = %+v, want both oldest first", due)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Opening the comments of a story again within this counts as the same visit
+const visitWindow = 30 * time.Minute
+
+// ReadState is how much of the comments of a story a user has seen.
+type ReadState struct {
+	ID           int32     `json:"id"`             // Id of the News
+	Opened       time.Time `json:"opened"`         // Last time the user opened the comments
+	Comments     int32     `json:"comments"`       // Number of comments on the News when last opened
+	MaxCommentID int32     `json:"max_comment_id"` // Highest Comment id seen
+}
+
+// ReadStates are stored with the start of the latest visit and the highest
+// Comment id seen before it
+type readRecord struct {
+	ReadState
+	VisitStart  time.Time `json:"visit_start"`
+	PrevMaxSeen int32     `json:"prev_max_seen"`
+}
+
+// There is a only one single database for the read state of all the users
+var (
+	Readdb = newDB("read-global")
+)
+
+// VisitStory records that the user opened the comments of the News, which
+// had the given number of comments, and saw the Comments up to maxCommentID.
+// Returns the highest Comment id seen before this visit and false if the
+// user never opened the comments before. Paging through the comments within
+// visitWindow is one visit.
+func VisitStory(username string, newsid int32, comments int32, maxCommentID int32) (int32, bool) {
+	var seen int32
+	opened := false
+	now := time.Now()
+	Readdb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(username))
+		if err != nil {
+			log.Println("VisitStory:", err)
+			return err
+		}
+		var r readRecord
+		if v := b.Get(readKey(newsid)); v != nil && json.Unmarshal(v, &r) == nil {
+			opened = true
+			if now.Sub(r.Opened) > visitWindow {
+				r.VisitStart = now
+				r.PrevMaxSeen = r.MaxCommentID
+			}
+		} else {
+			r = readRecord{ReadState: ReadState{ID: newsid}, VisitStart: now}
+		}
+		seen = r.PrevMaxSeen
+
+		r.Opened = now
+		if comments > r.Comments {
+			r.Comments = comments
+		}
+		if maxCommentID > r.MaxCommentID {
+			r.MaxCommentID = maxCommentID
+		}
+		v, err := json.Marshal(r)
+		if err != nil {
+			log.Println("VisitStory:", err)
+			return err
+		}
+		return b.Put(readKey(newsid), v)
+	})
+	return seen, opened
+}
+
+// ReadStates returns the ReadStates of the user of the News with the given
+// ids, News the user never opened are left out.
+func ReadStates(username string, ids []int32) map[int32]ReadState {
+	states := make(map[int32]ReadState)
+	Readdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(username))
+		if b == nil {
+			return nil
+		}
+		for _, id := range ids {
+			var r readRecord
+			if v := b.Get(readKey(id)); v != nil && json.Unmarshal(v, &r) == nil {
+				states[id] = r.ReadState
+			}
+		}
+		return nil
+	})
+	return states
+}
+
+// MaxCommentID returns the highest id of the Comments stored for the News.
+func MaxCommentID(newsid int) int32 {
+	var max int32
+	Commentsdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(strconv.Itoa(newsid)))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k []byte, v []byte) error {
+			var comment Comment
+			if json.Unmarshal(v, &comment) == nil && comment.ID > max {
+				max = comment.ID
+			}
+			return nil
+		})
+	})
+	return max
+}
+
+func readKey(newsid int32) []byte {
+	k := make([]byte, 4)
+	binary.BigEndian.PutUint32(k, uint32(newsid))
+	return k
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Moves the last visit of the user to the News back in time
+func ageVisit(t *testing.T, username string, newsid int32, by time.Duration) {
+	err := Readdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(username))
+		var r readRecord
+		if err := json.Unmarshal(b.Get(readKey(newsid)), &r); err != nil {
+			return err
+		}
+		r.Opened = r.Opened.Add(-by)
+		v, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(readKey(newsid), v)
+	})
+	if err != nil {
+		t.Fatalf("ageVisit: %v", err)
+	}
+}
+
+func TestVisitStory(t *testing.T) {
+	openTemp(t)
+	visits := []struct {
+		after        time.Duration // Time since the previous visit
+		comments     int32
+		maxCommentID int32
+		wantSeen     int32
+		wantOpened   bool
+	}{
+		{0, 10, 100, 0, false},
+		// Paging through the comments is the same visit
+		{time.Minute, 10, 120, 0, true},
+		{2 * visitWindow, 14, 130, 120, true},
+		// A page of older comments does not lower what was seen
+		{2 * visitWindow, 14, 90, 130, true},
+	}
+	for i, visit := range visits {
+		if i > 0 {
+			ageVisit(t, "alice", 1, visit.after)
+		}
+		seen, opened := VisitStory("alice", 1, visit.comments, visit.maxCommentID)
+		if seen != visit.wantSeen || opened != visit.wantOpened {
+			t.Errorf("visit %d: VisitStory = %d, %v, want %d, %v", i, seen, opened, visit.wantSeen, visit.wantOpened)
+		}
+	}
+
+	states := ReadStates("alice", []int32{1, 2})
+	if len(states) != 1 || states[1].Comments != 14 || states[1].MaxCommentID != 130 {
+		t.Errorf("ReadStates = %+v, want only story 1 with 14 comments up to 130", states)
+	}
+	if states := ReadStates("bob", []int32{1}); len(states) != 0 {
+		t.Errorf("ReadStates of another user = %+v, want none", states)
+	}
+}
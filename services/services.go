@@ -17,42 +17,76 @@ type News struct {
 	Rank     int32     `json:"rank"`
 	Title    string    `json:"title"`
 	Link     string    `json:"link"`
+	Domain   string    `json:"domain"` // Domain of the site Link points to, without www.
 	Author   string    `json:"author"`
 	Points   int32     `json:"points"`
 	Time     time.Time `json:"time"`
 	Comments int32     `json:"comments"` // Number of comments on the News
+
+	PrevRank  int32 `json:"prev_rank"`  // Rank on the list in the previous scrape, 0 if new to the list
+	RankDelta int32 `json:"rank_delta"` // Positions climbed since the previous scrape
+
+	Preview *LinkMeta `json:"preview,omitempty"` // Metadata of the page Link points to, once enriched
+
+	// Only set for a logged in user
+	Voted       bool  `json:"voted,omitempty"`        // The user has voted on the News
+	CanDownvote bool  `json:"can_downvote,omitempty"` // The user may downvote the News
+	IsOwn       bool  `json:"is_own,omitempty"`       // The user submitted the News
+	NewComments int32 `json:"new_comments,omitempty"` // Comments since the user last opened the News
 }
 
 // DatabaseService wraps a Bolt DB instance with application specific methods
 type DatabaseService struct {
-	newsdb *bolt.DB
+	name   string // Name of the list stored in newsdb
+	newsdb *DB
 }
 
 // There is a only one single database for all the comments
 var (
-	Commentsdb, _ = bolt.Open("comments-global", 0644, nil)
+	Commentsdb = newDB("comments-global")
 )
 
 // NewService creates a two new database on the given filepath with suffixes.
 func NewService(filepath string) *DatabaseService {
 	databaseService := new(DatabaseService)
-	newsdb, err := bolt.Open(filepath+"-news", 0644, nil)
+	databaseService.name = filepath
+	databaseService.newsdb = newDB(filepath + "-news")
+	newsdb, err := OpenBolt(dataPath(databaseService.newsdb.File), false)
 	if err != nil {
-		log.Panicf("Could not init database for filepath %s", filepath+"-news")
+		log.Panicln(err)
 	}
-	databaseService.newsdb = newsdb
+	databaseService.newsdb.Replace(newsdb)
 	return databaseService
 }
 
+// NewReplicaService creates a DatabaseService for the list with the given
+// name without opening its database, which is replaced by copies published
+// by the process scraping the list.
+func NewReplicaService(name string) *DatabaseService {
+	databaseService := new(DatabaseService)
+	databaseService.name = name
+	databaseService.newsdb = newDB(name + "-news")
+	return databaseService
+}
+
+// DB returns the database of the list.
+func (ds *DatabaseService) DB() *DB {
+	return ds.newsdb
+}
+
 // Close closes database connections
 func (ds *DatabaseService) Close() {
 	ds.newsdb.Close()
 }
 
-// ReadNews ...
+// ReadNews returns the News ranked from index from to index to, only as many
+// as were stored in the last scrape.
 func (ds *DatabaseService) ReadNews(from int, to int) []News {
 	var news []News
 	ds.newsdb.View(func(tx *bolt.Tx) error {
+		if count := countBuckets(tx); to > count {
+			to = count
+		}
 		for i := from; i <= to; i++ {
 			b := tx.Bucket([]byte(strconv.Itoa(int(i))))
 			if b == nil {
@@ -63,6 +97,7 @@ func (ds *DatabaseService) ReadNews(from int, to int) []News {
 			title := string(b.Get([]byte("title")))
 			author := string(b.Get([]byte("author")))
 			link := string(b.Get([]byte("link")))
+			domain := string(b.Get([]byte("domain")))
 
 			var rank int32
 			binary.Read(bytes.NewReader(b.Get([]byte("rank"))), binary.LittleEndian, &rank)
@@ -79,13 +114,36 @@ func (ds *DatabaseService) ReadNews(from int, to int) []News {
 			var id int32
 			binary.Read(bytes.NewReader(b.Get([]byte("id"))), binary.LittleEndian, &id)
 
-			news = append(news, News{id, rank, title, link, author, points, time.Unix(t, 0), comments})
+			news = append(news, News{ID: id, Rank: rank, Title: title, Link: link, Domain: domain,
+				Author: author, Points: points, Time: time.Unix(t, 0), Comments: comments})
 		}
 		return nil
 	})
+	annotateRanks(ds.name, news)
+	annotateLinks(news)
 	return news
 }
 
+// CountNews returns the number of News stored in the last scrape.
+func (ds *DatabaseService) CountNews() int {
+	count := 0
+	ds.newsdb.View(func(tx *bolt.Tx) error {
+		count = countBuckets(tx)
+		return nil
+	})
+	return count
+}
+
+// Returns the number of buckets, one per rank, in the database of a list
+func countBuckets(tx *bolt.Tx) int {
+	count := 0
+	tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		count++
+		return nil
+	})
+	return count
+}
+
 // SaveNews saves the News in the DB
 func (ds *DatabaseService) SaveNews(news []News) {
 	ds.newsdb.Update(func(tx *bolt.Tx) error {
@@ -98,6 +156,7 @@ func (ds *DatabaseService) SaveNews(news []News) {
 
 			b.Put([]byte("title"), []byte(aNews.Title))
 			b.Put([]byte("link"), []byte(aNews.Link))
+			b.Put([]byte("domain"), []byte(aNews.Domain))
 			b.Put([]byte("author"), []byte(aNews.Author))
 
 			var t bytes.Buffer
@@ -128,7 +187,8 @@ func (ds *DatabaseService) SaveNews(news []News) {
 func (ds *DatabaseService) ReadNewsIds() []int32 {
 	var ids []int32
 	ds.newsdb.View(func(tx *bolt.Tx) error {
-		for i := 1; i < 480; i++ {
+		count := countBuckets(tx)
+		for i := 1; i <= count; i++ {
 			b := tx.Bucket([]byte(strconv.Itoa(int(i))))
 			if b == nil {
 				log.Println("Bucket", i, "not found for newsid.")
@@ -153,6 +213,12 @@ type Comment struct {
 	Time     time.Time `json:"time"`
 	Author   string    `json:"author"`
 	Text     string    `json:"text"`
+
+	// Only set for a logged in user
+	Voted       bool `json:"voted,omitempty"`        // The user has voted on the Comment
+	CanDownvote bool `json:"can_downvote,omitempty"` // The user may downvote the Comment
+	IsOwn       bool `json:"is_own,omitempty"`       // The user wrote the Comment
+	New         bool `json:"new,omitempty"`          // Written since the user last opened the News
 }
 
 // SaveComments dumps the Comments into the comments database as JSON.
@@ -180,6 +246,46 @@ func SaveComments(comments []Comment) {
 	})
 }
 
+// ReplaceComments replaces all the Comments stored for the News, the thread
+// may have shrunk when a Comment was deleted.
+func ReplaceComments(newsid int32, comments []Comment) {
+	Commentsdb.Update(func(tx *bolt.Tx) error {
+		k := []byte(strconv.Itoa(int(newsid)))
+		if tx.Bucket(k) != nil {
+			if err := tx.DeleteBucket(k); err != nil {
+				log.Println("ReplaceComments:", err)
+				return err
+			}
+		}
+		b, err := tx.CreateBucket(k)
+		if err != nil {
+			log.Println("ReplaceComments:", err)
+			return err
+		}
+		for _, comment := range comments {
+			v, err := json.Marshal(comment)
+			if err != nil {
+				log.Println("ReplaceComments:", err)
+				continue
+			}
+			b.Put([]byte(strconv.Itoa(int(comment.Num))), v)
+		}
+		return nil
+	})
+}
+
+// CountComments returns the number of Comments stored for the News.
+func CountComments(newsid int) int {
+	count := 0
+	Commentsdb.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(strconv.Itoa(newsid))); b != nil {
+			count = b.Stats().KeyN
+		}
+		return nil
+	})
+	return count
+}
+
 // ReadComments Returns the comments on the News item specified by the id.
 func ReadComments(newsid int, from int, to int) []Comment {
 	var comments []Comment
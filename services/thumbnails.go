@@ -0,0 +1,53 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Thumbnail points to the thumbnail generated for the preview image of a News.
+type Thumbnail struct {
+	Hash      string    `json:"hash"`   // Hex SHA-256 of the thumbnail, empty if generating it failed
+	Source    string    `json:"source"` // URL of the image it was generated from
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// The thumbnails are stored next to the metadata of the links in Linksdb
+var thumbnailsBucket = []byte("thumbnails")
+
+// SaveThumbnail stores the Thumbnail of the News with the given id.
+func SaveThumbnail(newsid int32, thumbnail Thumbnail) {
+	v, err := json.Marshal(thumbnail)
+	if err != nil {
+		log.Println("SaveThumbnail:", err)
+		return
+	}
+	Linksdb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(thumbnailsBucket)
+		if err != nil {
+			log.Println("SaveThumbnail:", err)
+			return err
+		}
+		return b.Put([]byte(strconv.Itoa(int(newsid))), v)
+	})
+}
+
+// ReadThumbnail returns the Thumbnail of the News with the given id.
+func ReadThumbnail(newsid int) (Thumbnail, bool) {
+	var thumbnail Thumbnail
+	found := false
+	Linksdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(thumbnailsBucket)
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(strconv.Itoa(newsid)))
+		found = v != nil && json.Unmarshal(v, &thumbnail) == nil
+		return nil
+	})
+	return thumbnail, found
+}
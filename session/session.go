@@ -0,0 +1,369 @@
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors returned by the Store
+var (
+	ErrNotFound = errors.New("session: not found")
+	ErrExpired  = errors.New("session: expired")
+)
+
+// LastUsed is only written when it is older than this, saving a write per request
+const touchInterval = time.Minute
+
+// Session is a user logged in to Hacker News through us.
+type Session struct {
+	ID       string    `json:"id"` // Public id of the session, unlike the API key
+	Username string    `json:"username"`
+	Cookie   string    `json:"-"` // The user cookie from Hacker News
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Sessions are stored with their cookie, which is not part of their JSON
+type record struct {
+	Session
+	Cookie string `json:"cookie"`
+}
+
+// Store keeps the Sessions in Bolt, encrypted, keyed by a hash of their API key.
+type Store struct {
+	IdleTimeout time.Duration // Sessions not used for this long expire
+	MaxAge      time.Duration // Sessions expire this long after being created
+
+	db   *bolt.DB
+	aead cipher.AEAD
+}
+
+var sessionsBucket = []byte("sessions")
+
+// NewStore opens the Store at path encrypting the Sessions with the 32 byte key.
+func NewStore(path string, key []byte) (*Store, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// Fail instead of waiting if another process uses the same data directory
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("session: could not open %s: %v", path, err)
+	}
+	store := new(Store)
+	store.IdleTimeout = 30 * 24 * time.Hour
+	store.MaxAge = 90 * 24 * time.Hour
+	store.db = db
+	store.aead = aead
+	return store, nil
+}
+
+// LoadKey returns the key derived from secret, or if secret is empty the
+// key in the file at path, generating it the first time. A file that can't be
+// read or isn't a key is an error rather than replaced, since the sessions
+// encrypted with it could no longer be read.
+func LoadKey(secret string, path string) ([]byte, error) {
+	if secret != "" {
+		key := sha256.Sum256([]byte(secret))
+		return key[:], nil
+	}
+	key, err := ioutil.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("session: %s holds %d bytes, not a 32 byte key", path, len(key))
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, ioutil.WriteFile(path, key, 0600)
+}
+
+// Close closes the database connection
+func (store *Store) Close() {
+	store.db.Close()
+}
+
+// Create creates a Session for the user and returns its API key.
+func (store *Store) Create(username string, cookie string) (string, *Session, error) {
+	apikey, err := randomString(24)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := randomString(8)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	r := record{Session{ID: id, Username: username, Created: now, LastUsed: now}, cookie}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(sessionsBucket)
+		if err != nil {
+			return err
+		}
+		return store.put(b, hashKey(apikey), r)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return apikey, r.session(), nil
+}
+
+// Get returns the Session of the API key unless it has expired.
+func (store *Store) Get(apikey string) (*Session, error) {
+	var r record
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		r, err = store.get(tx, hashKey(apikey))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if store.expired(r, time.Now()) {
+		store.Delete(apikey)
+		return nil, ErrExpired
+	}
+
+	if time.Since(r.LastUsed) > touchInterval {
+		r.LastUsed = time.Now()
+		store.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(sessionsBucket)
+			if b == nil {
+				return ErrNotFound
+			}
+			return store.put(b, hashKey(apikey), r)
+		})
+	}
+	return r.session(), nil
+}
+
+// Delete deletes the Session of the API key, logging it out.
+func (store *Store) Delete(apikey string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sessionsBucket)
+		if b == nil || b.Get(hashKey(apikey)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete(hashKey(apikey))
+	})
+}
+
+// List returns the Sessions of the user that has not expired.
+func (store *Store) List(username string) []Session {
+	var sessions []Session
+	now := time.Now()
+	store.db.View(func(tx *bolt.Tx) error {
+		return store.forEach(tx, func(k []byte, r record) error {
+			if r.Username == username && !store.expired(r, now) {
+				sessions = append(sessions, r.Session)
+			}
+			return nil
+		})
+	})
+	return sessions
+}
+
+// Active returns the most recently used Session of every user with a Session
+// that has not expired, including their cookies.
+func (store *Store) Active() []*Session {
+	latest := make(map[string]record)
+	now := time.Now()
+	store.db.View(func(tx *bolt.Tx) error {
+		return store.forEach(tx, func(k []byte, r record) error {
+			if store.expired(r, now) {
+				return nil
+			}
+			if other, ok := latest[r.Username]; !ok || r.LastUsed.After(other.LastUsed) {
+				latest[r.Username] = r
+			}
+			return nil
+		})
+	})
+
+	var sessions []*Session
+	for _, r := range latest {
+		sessions = append(sessions, r.session())
+	}
+	return sessions
+}
+
+// Revoke deletes the Session of the user with the given public id.
+func (store *Store) Revoke(username string, id string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		var key []byte
+		store.forEach(tx, func(k []byte, r record) error {
+			if r.Username == username && r.ID == id {
+				key = append([]byte(nil), k...)
+			}
+			return nil
+		})
+		if key == nil {
+			return ErrNotFound
+		}
+		return tx.Bucket(sessionsBucket).Delete(key)
+	})
+}
+
+// Rotate replaces the API key of a Session with a new one, keeping the user
+// logged in to Hacker News.
+func (store *Store) Rotate(apikey string) (string, error) {
+	newKey, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		r, err := store.get(tx, hashKey(apikey))
+		if err != nil {
+			return err
+		}
+		if store.expired(r, time.Now()) {
+			return ErrExpired
+		}
+		b := tx.Bucket(sessionsBucket)
+		if err := b.Delete(hashKey(apikey)); err != nil {
+			return err
+		}
+		return store.put(b, hashKey(newKey), r)
+	})
+	if err != nil {
+		return "", err
+	}
+	return newKey, nil
+}
+
+// Purge deletes all the expired Sessions.
+func (store *Store) Purge() {
+	now := time.Now()
+	store.db.Update(func(tx *bolt.Tx) error {
+		var expired [][]byte
+		store.forEach(tx, func(k []byte, r record) error {
+			if store.expired(r, now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range expired {
+			tx.Bucket(sessionsBucket).Delete(k)
+		}
+		if len(expired) > 0 {
+			log.Println(len(expired), "expired sessions purged.")
+		}
+		return nil
+	})
+}
+
+// StartPurging purges the expired Sessions every interval until ctx is done,
+// run as a goroutine.
+func (store *Store) StartPurging(ctx context.Context, interval time.Duration) {
+	for {
+		store.Purge()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (store *Store) expired(r record, now time.Time) bool {
+	return now.Sub(r.LastUsed) > store.IdleTimeout || now.Sub(r.Created) > store.MaxAge
+}
+
+// Sessions are stored as the nonce followed by the sealed JSON
+func (store *Store) put(b *bolt.Bucket, k []byte, r record) error {
+	plain, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, store.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	return b.Put(k, store.aead.Seal(nonce, nonce, plain, k))
+}
+
+func (store *Store) get(tx *bolt.Tx, k []byte) (record, error) {
+	var r record
+	b := tx.Bucket(sessionsBucket)
+	if b == nil {
+		return r, ErrNotFound
+	}
+	v := b.Get(k)
+	if v == nil {
+		return r, ErrNotFound
+	}
+	return r, store.open(k, v, &r)
+}
+
+func (store *Store) open(k []byte, v []byte, r *record) error {
+	size := store.aead.NonceSize()
+	if len(v) < size {
+		return ErrNotFound
+	}
+	plain, err := store.aead.Open(nil, v[:size], v[size:], k)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, r)
+}
+
+// Calls fn with every Session that can be decrypted
+func (store *Store) forEach(tx *bolt.Tx, fn func(k []byte, r record) error) error {
+	b := tx.Bucket(sessionsBucket)
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(func(k []byte, v []byte) error {
+		var r record
+		if store.open(k, v, &r) != nil {
+			return nil
+		}
+		return fn(k, r)
+	})
+}
+
+func (r record) session() *Session {
+	session := r.Session
+	session.Cookie = r.Cookie
+	return &session
+}
+
+// API keys are only stored hashed so that a leaked database holds no keys
+func hashKey(apikey string) []byte {
+	sum := sha256.Sum256([]byte(apikey))
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func newTestStore(t *testing.T, key []byte) (*Store, string) {
+	path := filepath.Join(t.TempDir(), "sessions")
+	store, err := NewStore(path, key)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	return store, path
+}
+
+func TestSessionsAreEncrypted(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	store, path := newTestStore(t, key)
+	apikey, _, err := store.Create("alice", "alice&secretcookie")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	s, err := store.Get(apikey)
+	if err != nil || s.Username != "alice" || s.Cookie != "alice&secretcookie" {
+		t.Fatalf("Get = %+v, %v, want the session of alice", s, err)
+	}
+	store.Close()
+
+	// Neither the cookie nor the API key is stored in the clear
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("bolt.Open: %v", err)
+	}
+	db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k []byte, v []byte) error {
+			if bytes.Contains(v, []byte("secretcookie")) || bytes.Contains(k, []byte(apikey)) {
+				t.Errorf("session stored in the clear: %q = %q", k, v)
+			}
+			return nil
+		})
+	})
+	db.Close()
+
+	// A different key cannot open the sessions
+	other, err := NewStore(path, bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer other.Close()
+	if _, err := other.Get(apikey); err == nil {
+		t.Error("Get with the wrong key succeeded")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	store, _ := newTestStore(t, bytes.Repeat([]byte{1}, 32))
+	defer store.Close()
+	apikey, _, err := store.Create("alice", "cookie")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	store.IdleTimeout = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, err := store.Get(apikey); err != ErrExpired {
+		t.Errorf("Get of an idle session = %v, want %v", err, ErrExpired)
+	}
+	if _, err := store.Get(apikey); err != ErrNotFound {
+		t.Errorf("Get after expiry = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSessionRotate(t *testing.T) {
+	store, _ := newTestStore(t, bytes.Repeat([]byte{1}, 32))
+	defer store.Close()
+	apikey, _, err := store.Create("alice", "cookie")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	newKey, err := store.Rotate(apikey)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if _, err := store.Get(apikey); err != ErrNotFound {
+		t.Errorf("Get with the old key = %v, want %v", err, ErrNotFound)
+	}
+	if s, err := store.Get(newKey); err != nil || s.Cookie != "cookie" {
+		t.Errorf("Get with the new key = %+v, %v, want the session", s, err)
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.key")
+	generated, err := LoadKey("", path)
+	if err != nil || len(generated) != 32 {
+		t.Fatalf("LoadKey = %x, %v, want a 32 byte key", generated, err)
+	}
+	loaded, err := LoadKey("", path)
+	if err != nil || !bytes.Equal(loaded, generated) {
+		t.Errorf("LoadKey again = %x, %v, want the generated key", loaded, err)
+	}
+	derived, err := LoadKey("secret", path)
+	if err != nil || len(derived) != 32 || bytes.Equal(derived, generated) {
+		t.Errorf("LoadKey with a secret = %x, %v, want a key derived from it", derived, err)
+	}
+}
+
+func TestLoadKeyNeverReplacesAFile(t *testing.T) {
+	dir := t.TempDir()
+	short := filepath.Join(dir, "short.key")
+	ioutil.WriteFile(short, []byte("not a key"), 0600)
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"wrong length", short},
+		{"not a file", dir},
+	}
+	for _, test := range tests {
+		if key, err := LoadKey("", test.path); err == nil {
+			t.Errorf("%s: LoadKey = %x, want an error", test.name, key)
+		}
+	}
+	if data, _ := ioutil.ReadFile(short); string(data) != "not a key" {
+		t.Errorf("the key file was replaced with %x", data)
+	}
+}